@@ -1,27 +1,459 @@
 package iproto
 
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ = log.Print
+
+// BalancerPoint distributes requests among its children.
+// Without Strategy every child reads from one shared channel, so whichever
+// child is free first wins. With Strategy each child gets its own queue and
+// the balancer picks a child for every request.
 type BalancerPoint struct {
 	SimplePoint
-	children []EndPoint
+	Strategy BalanceStrategy
+	// ChildQueue is a size of per child queue, used only with Strategy
+	ChildQueue int
+
+	m           sync.Mutex
+	children    []*BalancerChild
+	alive       []*BalancerChild
+	dispatching bool
+}
+
+const defaultChildQueue = 1024
+
+// BalanceStrategy picks a child for a next request.
+// Pick is called only from balancer's loop under balancer's lock, so implementation
+// may keep state and read child's Weight without locking. alive is never empty.
+type BalanceStrategy interface {
+	Pick(alive []*BalancerChild) *BalancerChild
+}
+
+type BalancerChild struct {
+	EndPoint
+	Weight int
+
+	ch      chan *Request
+	runned  bool
+	drained bool
+	ejected uint32
+	inFly   int32
+	ewma    int64
+	current int
+}
+
+// InFly returns number of requests sent to child and not yet answered
+func (c *BalancerChild) InFly() int {
+	return int(atomic.LoadInt32(&c.inFly))
+}
+
+// Latency returns exponentially weighted moving average of child's response time
+func (c *BalancerChild) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.ewma))
+}
+
+func (c *BalancerChild) Ejected() bool {
+	return atomic.LoadUint32(&c.ejected) != 0
+}
+
+const ewmaShift = 3
+
+func (c *BalancerChild) observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&c.ewma)
+		n := int64(d)
+		if old != 0 {
+			n = old + (int64(d)-old)>>ewmaShift
+		}
+		if atomic.CompareAndSwapInt64(&c.ewma, old, n) {
+			return
+		}
+	}
+}
+
+type balancerBookmark struct {
+	Bookmark
+	c *BalancerChild
+	e Epoch
+}
+
+func (bm *balancerBookmark) Respond(res *Response) {
+	atomic.AddInt32(&bm.c.inFly, -1)
+	if res.Code != RcCanceled {
+		bm.c.observe(bm.e.Elapsed())
+	}
 }
 
 func (b *BalancerPoint) Init() {
 	b.SimplePoint.Init(b)
 }
 
+// Run fixes balancing mode: children share balancer's queue only if Strategy is not set at this moment
+func (b *BalancerPoint) Run(ch chan *Request) {
+	b.m.Lock()
+	b.dispatching = b.Strategy != nil
+	b.m.Unlock()
+	b.SimplePoint.Run(ch)
+}
+
 func (b *BalancerPoint) AddChild(ch EndPoint) {
-	b.children = append(b.children, ch)
-	if b.Runned() {
-		ch.Run(b.b.ch)
+	b.AddChildWeight(ch, 1)
+}
+
+func (b *BalancerPoint) AddChildWeight(ch EndPoint, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	c := &BalancerChild{EndPoint: ch, Weight: weight}
+	b.m.Lock()
+	b.children = append(b.children, c)
+	b.fixAlive()
+	runned := b.Runned()
+	c.runned = runned
+	b.m.Unlock()
+	if runned {
+		b.runChild(c)
+	}
+}
+
+// RemoveChild removes child from balancer. Without Strategy child is stopped immediately.
+// With Strategy new requests are not sent to child, and it is stopped when requests already
+// queued to it are answered, but not later than drain. Requests left in its queue are answered with RcShutdown.
+func (b *BalancerPoint) RemoveChild(ch EndPoint, drain time.Duration) {
+	b.m.Lock()
+	c := b.find(ch)
+	if c == nil {
+		b.m.Unlock()
+		return
+	}
+	for i, cc := range b.children {
+		if cc == c {
+			copy(b.children[i:], b.children[i+1:])
+			b.children[len(b.children)-1] = nil
+			b.children = b.children[:len(b.children)-1]
+			break
+		}
+	}
+	b.fixAlive()
+	runned, dispatching := c.runned, b.dispatching
+	b.m.Unlock()
+	if !runned {
+		return
+	}
+	if !dispatching {
+		c.Stop()
+		return
+	}
+	go b.drainChild(c, drain)
+}
+
+const drainPollInterval = 10 * time.Millisecond
+
+func (b *BalancerPoint) drainChild(c *BalancerChild, drain time.Duration) {
+	deadline := time.Now().Add(drain)
+	/* dispatch could pick child from alive snapshot taken before removal, so wait at least once */
+	for {
+		time.Sleep(drainPollInterval)
+		if c.InFly() == 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	c.Stop()
+	/* dispatch checks the flag after every send, so request sent after drain below is not lost */
+	b.m.Lock()
+	c.drained = true
+	b.m.Unlock()
+	c.shutdownQueued()
+}
+
+func (c *BalancerChild) shutdownQueued() {
+	for {
+		select {
+		case req := <-c.ch:
+			req.ShutDown()
+		default:
+			return
+		}
+	}
+}
+
+func (b *BalancerPoint) runChild(c *BalancerChild) {
+	b.m.Lock()
+	if !b.dispatching {
+		b.m.Unlock()
+		b.RunChild(c.EndPoint)
+		return
+	}
+	n := b.ChildQueue
+	if n <= 0 {
+		n = defaultChildQueue
+	}
+	ch := make(chan *Request, n)
+	c.ch = ch
+	/* child becomes visible to dispatch only when it has a queue */
+	b.fixAlive()
+	b.m.Unlock()
+	c.EndPoint.Run(ch)
+}
+
+func (b *BalancerPoint) find(ch EndPoint) *BalancerChild {
+	for _, c := range b.children {
+		if c.EndPoint == ch {
+			return c
+		}
+	}
+	return nil
+}
+
+func (b *BalancerPoint) fixAlive() {
+	alive := make([]*BalancerChild, 0, len(b.children))
+	for _, c := range b.children {
+		if c.ch != nil && !c.Ejected() {
+			alive = append(alive, c)
+		}
+	}
+	b.alive = alive
+}
+
+// SetWeight changes weight of a child. Weight is used only by Weighted strategy.
+func (b *BalancerPoint) SetWeight(ch EndPoint, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	b.m.Lock()
+	if c := b.find(ch); c != nil {
+		c.Weight = weight
+	}
+	b.m.Unlock()
+}
+
+// Eject stops sending new requests to a child. Requests already queued to it will be performed.
+// Eject works only with Strategy; if it is not set before Run, balancer uses RoundRobin.
+func (b *BalancerPoint) Eject(ch EndPoint) {
+	b.setEjected(ch, true)
+}
+
+// Readmit returns ejected child back to rotation
+func (b *BalancerPoint) Readmit(ch EndPoint) {
+	b.setEjected(ch, false)
+}
+
+func (b *BalancerPoint) setEjected(ch EndPoint, ejected bool) {
+	var v uint32
+	if ejected {
+		v = 1
+	}
+	b.m.Lock()
+	if b.Strategy == nil {
+		if b.Runned() {
+			log.Printf("BalancerPoint without Strategy shares one queue among children, Eject has no effect")
+		} else {
+			b.Strategy = &RoundRobin{}
+		}
 	}
+	if c := b.find(ch); c != nil {
+		atomic.StoreUint32(&c.ejected, v)
+		b.fixAlive()
+	}
+	b.m.Unlock()
+}
+
+// Children returns snapshot of all children, ejected included
+func (b *BalancerPoint) Children() []*BalancerChild {
+	b.m.Lock()
+	children := make([]*BalancerChild, len(b.children))
+	copy(children, b.children)
+	b.m.Unlock()
+	return children
 }
 
 func (b *BalancerPoint) Loop() {
-	for _, ch := range b.children {
-		b.RunChild(ch)
+	var children []*BalancerChild
+	b.m.Lock()
+	dispatching := b.dispatching
+	for _, c := range b.children {
+		/* child added after Run is started by AddChildWeight */
+		if !c.runned {
+			c.runned = true
+			children = append(children, c)
+		}
+	}
+	b.m.Unlock()
+	for _, c := range children {
+		b.runChild(c)
+	}
+	if dispatching {
+		b.dispatch()
+	} else {
+		<-b.ExitChan()
+	}
+	for _, c := range b.Children() {
+		c.Stop()
+	}
+}
+
+func (b *BalancerPoint) dispatch() {
+	for {
+		var req *Request
+		var ok bool
+		select {
+		case <-b.ExitChan():
+			b.shutdownQueued()
+			return
+		case req, ok = <-b.ReceiveChan():
+			if !ok {
+				<-b.ExitChan()
+				return
+			}
+		}
+
+		b.m.Lock()
+		c := b.pick()
+		b.m.Unlock()
+		if c == nil {
+			req.IOError()
+			continue
+		}
+
+		bm := &balancerBookmark{c: c, e: NowEpoch()}
+		if !req.ChainBookmark(bm) {
+			continue
+		}
+		atomic.AddInt32(&c.inFly, 1)
+		select {
+		case c.ch <- req:
+		default:
+			/* every alive child is busy, wait for picked one */
+			select {
+			case c.ch <- req:
+			case <-b.ExitChan():
+				req.ShutDown()
+				b.shutdownQueued()
+				return
+			}
+		}
+		b.m.Lock()
+		drained := c.drained
+		b.m.Unlock()
+		if drained {
+			/* child were removed and stopped while request were on its way */
+			c.shutdownQueued()
+		}
+	}
+}
+
+// pick asks Strategy for a child, but skips it for other one if its queue is full,
+// so single stuck child does not stall whole balancer. Should be called under lock.
+func (b *BalancerPoint) pick() *BalancerChild {
+	if len(b.alive) == 0 {
+		return nil
+	}
+	c := b.Strategy.Pick(b.alive)
+	/* only dispatch sends to child's queue, so it is not full until next send */
+	if len(c.ch) < cap(c.ch) {
+		return c
+	}
+	for _, o := range b.alive {
+		if len(o.ch) < cap(o.ch) {
+			return o
+		}
 	}
-	<-b.ExitChan()
-	for _, ch := range b.children {
-		ch.Stop()
+	return c
+}
+
+func (b *BalancerPoint) shutdownQueued() {
+	ch := b.ReceiveChan()
+	for {
+		select {
+		case req := <-ch:
+			req.ShutDown()
+		default:
+			return
+		}
+	}
+}
+
+// RoundRobin sends requests to children in turn
+type RoundRobin struct {
+	i int
+}
+
+func (s *RoundRobin) Pick(alive []*BalancerChild) *BalancerChild {
+	s.i++
+	if s.i >= len(alive) {
+		s.i = 0
+	}
+	return alive[s.i]
+}
+
+// LeastInFly sends request to a child with least number of requests in fly
+type LeastInFly struct {
+	i int
+}
+
+func (s *LeastInFly) Pick(alive []*BalancerChild) *BalancerChild {
+	s.i++
+	n := len(alive)
+	best := alive[s.i%n]
+	bestn := best.InFly()
+	for j := 1; j < n && bestn > 0; j++ {
+		c := alive[(s.i+j)%n]
+		if cn := c.InFly(); cn < bestn {
+			best, bestn = c, cn
+		}
+	}
+	return best
+}
+
+// PowerOfTwo choose two random children and sends request to one with lesser EWMA latency.
+// Latency is multiplied by number of requests in fly, so slow child with big queue is penalized.
+type PowerOfTwo struct {
+	Rand *rand.Rand
+}
+
+func (s *PowerOfTwo) cost(c *BalancerChild) int64 {
+	return int64(c.Latency()) * int64(c.InFly()+1)
+}
+
+func (s *PowerOfTwo) Pick(alive []*BalancerChild) *BalancerChild {
+	n := len(alive)
+	if n == 1 {
+		return alive[0]
+	}
+	if s.Rand == nil {
+		s.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	i := s.Rand.Intn(n)
+	j := s.Rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	a, b := alive[i], alive[j]
+	if s.cost(b) < s.cost(a) {
+		return b
+	}
+	return a
+}
+
+// Weighted is a smooth weighted round robin (as in nginx)
+type Weighted struct{}
+
+func (s Weighted) Pick(alive []*BalancerChild) *BalancerChild {
+	var best *BalancerChild
+	total := 0
+	for _, c := range alive {
+		c.current += c.Weight
+		total += c.Weight
+		if best == nil || c.current > best.current {
+			best = c
+		}
 	}
+	best.current -= total
+	return best
 }
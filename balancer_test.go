@@ -0,0 +1,229 @@
+package iproto
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type testChild struct {
+	SimplePoint
+	id   uint32
+	hold chan struct{}
+	held chan struct{}
+}
+
+func newTestChild(id uint32) *testChild {
+	c := &testChild{id: id}
+	c.SimplePoint.Init(c)
+	return c
+}
+
+func (c *testChild) Loop() {
+	for {
+		select {
+		case <-c.ExitChan():
+			return
+		case req := <-c.ReceiveChan():
+			if c.hold != nil {
+				c.held <- struct{}{}
+				<-c.hold
+			}
+			if req.SetInFly(nil) {
+				req.Respond(RcOK, c.id)
+			}
+		}
+	}
+}
+
+func newTestBalancer(s BalanceStrategy, n int) (*BalancerPoint, []*testChild) {
+	b := &BalancerPoint{Strategy: s}
+	b.Init()
+	children := make([]*testChild, n)
+	for i := range children {
+		children[i] = newTestChild(uint32(i))
+		b.AddChild(children[i])
+	}
+	return b, children
+}
+
+func callId(t *testing.T, b *BalancerPoint) uint32 {
+	res := CallMsgBody(b, 1, Body(nil))
+	if res.Code != RcOK {
+		t.Fatalf("unexpected code %v", res.Code)
+	}
+	var id uint32
+	if err := Body(res.Body).Read(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func countIds(t *testing.T, b *BalancerPoint, n, children int) []int {
+	counts := make([]int, children)
+	for i := 0; i < n; i++ {
+		counts[callId(t, b)]++
+	}
+	return counts
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b, _ := newTestBalancer(&RoundRobin{}, 3)
+	Run(b)
+	defer b.Stop()
+	for i, n := range countIds(t, b, 9, 3) {
+		if n != 3 {
+			t.Errorf("child %d got %d requests, want 3", i, n)
+		}
+	}
+}
+
+func TestBalancerWeighted(t *testing.T) {
+	b, children := newTestBalancer(Weighted{}, 2)
+	b.SetWeight(children[0], 3)
+	Run(b)
+	defer b.Stop()
+	if counts := countIds(t, b, 8, 2); counts[0] != 6 || counts[1] != 2 {
+		t.Errorf("weights 3:1 give %v", counts)
+	}
+}
+
+func TestBalancerLeastInFly(t *testing.T) {
+	b, children := newTestBalancer(&LeastInFly{}, 2)
+	/* first pick is second child, let it stuck */
+	children[1].hold = make(chan struct{})
+	children[1].held = make(chan struct{}, 1)
+	Run(b)
+	defer b.Stop()
+	_, res := SendMsgBody(b, 1, Body(nil))
+	for i := 0; i < 4; i++ {
+		if id := callId(t, b); id != 0 {
+			t.Errorf("request %d is sent to busy child", i)
+		}
+	}
+	close(children[1].hold)
+	<-res
+}
+
+func TestBalancerEject(t *testing.T) {
+	b, children := newTestBalancer(&RoundRobin{}, 2)
+	Run(b)
+	defer b.Stop()
+	b.Eject(children[0])
+	if !b.Children()[0].Ejected() {
+		t.Errorf("child is not marked ejected")
+	}
+	if counts := countIds(t, b, 4, 2); counts[0] != 0 {
+		t.Errorf("ejected child got %d requests", counts[0])
+	}
+	b.Readmit(children[0])
+	if counts := countIds(t, b, 4, 2); counts[0] != 2 || counts[1] != 2 {
+		t.Errorf("readmitted balancer gives %v", counts)
+	}
+
+	b.Eject(children[0])
+	b.Eject(children[1])
+	if res := CallMsgBody(b, 1, Body(nil)); res.Code != RcIOError {
+		t.Errorf("all ejected gives %v", res.Code)
+	}
+}
+
+func TestBalancerEjectWithoutStrategy(t *testing.T) {
+	b, children := newTestBalancer(nil, 2)
+	b.Eject(children[1])
+	if _, ok := b.Strategy.(*RoundRobin); !ok {
+		t.Fatalf("Eject sets strategy %#v", b.Strategy)
+	}
+	Run(b)
+	defer b.Stop()
+	if counts := countIds(t, b, 4, 2); counts[1] != 0 {
+		t.Errorf("ejected child got %d requests", counts[1])
+	}
+}
+
+func TestBalancerSkipsBusyChild(t *testing.T) {
+	b, children := newTestBalancer(&RoundRobin{}, 2)
+	b.ChildQueue = 1
+	children[1].hold = make(chan struct{})
+	children[1].held = make(chan struct{}, 2)
+	Run(b)
+	defer b.Stop()
+	/* second child takes first request and stucks, third request fills its queue */
+	_, res1 := SendMsgBody(b, 1, Body(nil))
+	<-children[1].held
+	callId(t, b)
+	_, res3 := SendMsgBody(b, 1, Body(nil))
+	for i := 0; i < 3; i++ {
+		if id := callId(t, b); id != 0 {
+			t.Errorf("request is sent to busy child")
+		}
+	}
+	close(children[1].hold)
+	<-res1
+	<-res3
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	/* cost is latency multiplied by requests in fly plus one */
+	alive := []*BalancerChild{{ewma: 40}, {ewma: 10}, {ewma: 10, inFly: 2}}
+	s := &PowerOfTwo{Rand: rand.New(rand.NewSource(1))}
+	counts := make(map[*BalancerChild]int)
+	for i := 0; i < 300; i++ {
+		counts[s.Pick(alive)]++
+	}
+	if counts[alive[0]] != 0 {
+		t.Errorf("costliest child picked %d times", counts[alive[0]])
+	}
+	if counts[alive[1]] <= counts[alive[2]] {
+		t.Errorf("cheapest child picked %d times, loaded one %d", counts[alive[1]], counts[alive[2]])
+	}
+
+	b, _ := newTestBalancer(&PowerOfTwo{}, 2)
+	Run(b)
+	defer b.Stop()
+	countIds(t, b, 10, 2)
+}
+
+func TestBalancerRemoveChild(t *testing.T) {
+	b, children := newTestBalancer(&RoundRobin{}, 2)
+	children[1].hold = make(chan struct{})
+	children[1].held = make(chan struct{}, 2)
+	Run(b)
+	defer b.Stop()
+	/* second child takes first request and stucks, third one waits in its queue */
+	_, res1 := SendMsgBody(b, 1, Body(nil))
+	<-children[1].held
+	callId(t, b)
+	_, res3 := SendMsgBody(b, 1, Body(nil))
+	for i := 0; b.Children()[1].InFly() != 2; i++ {
+		if i == 100 {
+			t.Fatalf("request is not queued to child")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	b.RemoveChild(children[1], time.Second)
+	if n := len(b.Children()); n != 1 {
+		t.Errorf("%d children after removal", n)
+	}
+	for i := 0; i < 3; i++ {
+		if id := callId(t, b); id != 0 {
+			t.Errorf("request is sent to removed child")
+		}
+	}
+	if children[1].Stopped() {
+		t.Errorf("child with requests in fly is stopped")
+	}
+	close(children[1].hold)
+	for _, res := range []Chan{res1, res3} {
+		if r := <-res; r.Code != RcOK || r.Body[0] != 1 {
+			t.Errorf("request in fly answered with %x %v", r.Code, r.Body)
+		}
+	}
+	for i := 0; !children[1].Stopped(); i++ {
+		if i == 100 {
+			t.Fatalf("drained child is not stopped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,255 @@
+package iproto
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState uint32
+
+const (
+	BreakerClosed = BreakerState(iota)
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	DefaultBreakerWindow      = 10 * time.Second
+	DefaultBreakerBuckets     = 10
+	DefaultBreakerMinRequests = 20
+	DefaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// CircuitBreaker wraps Service and rejects requests with RcCircuitOpen while service looks broken.
+//
+// Breaker is tripped when, over sliding Window, at least MinRequests were answered and
+// share of errors reaches ErrorRate or share of timeouts reaches TimeoutRate (zero rate disables check).
+// After OpenTimeout breaker lets HalfOpenRequests probes through: if all of them succeed breaker
+// closes, otherwise it opens again.
+//
+// OnStateChange is called on each transition. It is called synchronously, possibly while
+// some request is locked, so it should not block.
+type CircuitBreaker struct {
+	Service
+	Name string
+
+	Window           time.Duration
+	Buckets          int
+	MinRequests      int
+	ErrorRate        float64
+	TimeoutRate      float64
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+
+	// IsError decides which return codes are counted as errors. By default RcIOError and RcTemporary kind codes are.
+	IsError       func(RetCode) bool
+	OnStateChange func(name string, from, to BreakerState)
+
+	m        sync.Mutex
+	state    BreakerState
+	openedAt Epoch
+	probes   int
+	probesOk int
+	buckets  []breakerBucket
+	cur      int
+	curStart Epoch
+}
+
+type breakerBucket struct {
+	total, errors, timeouts int
+}
+
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+	return cb.state
+}
+
+func (cb *CircuitBreaker) Send(r *Request) {
+	ok, probe, from, to := cb.allow()
+	if from != to {
+		cb.notify(from, to)
+	}
+	if !ok {
+		r.RespondFail(RcCircuitOpen)
+		return
+	}
+	if r.ChainBookmark(&breakerBookmark{cb: cb, probe: probe}) {
+		cb.Service.Send(r)
+	} else if probe {
+		cb.m.Lock()
+		cb.probes--
+		cb.m.Unlock()
+	}
+}
+
+func (cb *CircuitBreaker) isError(code RetCode) bool {
+	if cb.IsError != nil {
+		return cb.IsError(code)
+	}
+	return code == RcIOError || code&RcKindMask == RcTemporary
+}
+
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.OpenTimeout <= 0 {
+		return DefaultBreakerOpenTimeout
+	}
+	return cb.OpenTimeout
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests <= 0 {
+		return 1
+	}
+	return cb.HalfOpenRequests
+}
+
+func (cb *CircuitBreaker) allow() (ok, probe bool, from, to BreakerState) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+	from, to = cb.state, cb.state
+	switch cb.state {
+	case BreakerClosed:
+		return true, false, from, to
+	case BreakerOpen:
+		if cb.openedAt.Elapsed() < cb.openTimeout() {
+			return false, false, from, to
+		}
+		cb.setState(BreakerHalfOpen)
+		to = BreakerHalfOpen
+	}
+	if cb.probes < cb.halfOpenRequests() {
+		cb.probes++
+		return true, true, from, to
+	}
+	return false, false, from, to
+}
+
+func (cb *CircuitBreaker) setState(st BreakerState) {
+	cb.state = st
+	cb.probes = 0
+	cb.probesOk = 0
+	switch st {
+	case BreakerOpen:
+		cb.openedAt = NowEpoch()
+	case BreakerClosed:
+		cb.buckets = nil
+	}
+}
+
+func (cb *CircuitBreaker) notify(from, to BreakerState) {
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(cb.Name, from, to)
+	}
+}
+
+func (cb *CircuitBreaker) advance(now Epoch) {
+	n := cb.Buckets
+	if n <= 0 {
+		n = DefaultBreakerBuckets
+	}
+	window := cb.Window
+	if window <= 0 {
+		window = DefaultBreakerWindow
+	}
+	width := window / time.Duration(n)
+	if cb.buckets == nil || now.Sub(cb.curStart) >= window {
+		cb.buckets = make([]breakerBucket, n)
+		cb.cur = 0
+		cb.curStart = now
+		return
+	}
+	for now.Sub(cb.curStart) >= width {
+		cb.cur = (cb.cur + 1) % n
+		cb.buckets[cb.cur] = breakerBucket{}
+		cb.curStart = cb.curStart.Add(width)
+	}
+}
+
+func (cb *CircuitBreaker) tripped() bool {
+	var sum breakerBucket
+	for _, b := range cb.buckets {
+		sum.total += b.total
+		sum.errors += b.errors
+		sum.timeouts += b.timeouts
+	}
+	min := cb.MinRequests
+	if min <= 0 {
+		min = DefaultBreakerMinRequests
+	}
+	if sum.total < min {
+		return false
+	}
+	total := float64(sum.total)
+	return (cb.ErrorRate > 0 && float64(sum.errors)/total >= cb.ErrorRate) ||
+		(cb.TimeoutRate > 0 && float64(sum.timeouts)/total >= cb.TimeoutRate)
+}
+
+func (cb *CircuitBreaker) record(code RetCode, probe bool) {
+	if code == RcCanceled {
+		if probe {
+			cb.m.Lock()
+			if cb.state == BreakerHalfOpen {
+				cb.probes--
+			}
+			cb.m.Unlock()
+		}
+		return
+	}
+	timeout := code == RcTimeout
+	failed := timeout || cb.isError(code)
+
+	cb.m.Lock()
+	from := cb.state
+	switch cb.state {
+	case BreakerHalfOpen:
+		if !probe {
+			break
+		}
+		if failed {
+			cb.setState(BreakerOpen)
+		} else if cb.probesOk++; cb.probesOk >= cb.halfOpenRequests() {
+			cb.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		cb.advance(NowEpoch())
+		b := &cb.buckets[cb.cur]
+		b.total++
+		if timeout {
+			b.timeouts++
+		} else if failed {
+			b.errors++
+		}
+		if cb.tripped() {
+			cb.setState(BreakerOpen)
+		}
+	}
+	to := cb.state
+	cb.m.Unlock()
+
+	if from != to {
+		cb.notify(from, to)
+	}
+}
+
+type breakerBookmark struct {
+	Bookmark
+	cb    *CircuitBreaker
+	probe bool
+}
+
+func (bm *breakerBookmark) Respond(res *Response) {
+	bm.cb.record(res.Code, bm.probe)
+}
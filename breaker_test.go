@@ -0,0 +1,120 @@
+package iproto
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const testOpenTimeout = 20 * time.Millisecond
+
+type breakerStep struct {
+	code  RetCode /* code answered by service */
+	wait  bool    /* wait for OpenTimeout before request */
+	res   RetCode /* code request is answered with */
+	state BreakerState
+}
+
+var breakerCases = []struct {
+	name        string
+	cb          func() *CircuitBreaker
+	steps       []breakerStep
+	transitions string
+}{
+	{
+		name: "errors trip breaker",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 2, ErrorRate: 0.5} },
+		steps: []breakerStep{
+			{code: RcOK, res: RcOK, state: BreakerClosed},
+			{code: RcIOError, res: RcIOError, state: BreakerOpen},
+			{code: RcOK, res: RcCircuitOpen, state: BreakerOpen},
+		},
+		transitions: "closed>open",
+	},
+	{
+		name: "timeouts trip breaker",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 2, TimeoutRate: 1} },
+		steps: []breakerStep{
+			{code: RcTimeout, res: RcTimeout, state: BreakerClosed},
+			{code: RcTimeout, res: RcTimeout, state: BreakerOpen},
+		},
+		transitions: "closed>open",
+	},
+	{
+		name: "too few requests",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 3, ErrorRate: 0.5} },
+		steps: []breakerStep{
+			{code: RcIOError, res: RcIOError, state: BreakerClosed},
+			{code: RcIOError, res: RcIOError, state: BreakerClosed},
+		},
+	},
+	{
+		name: "fatal codes are not errors",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 2, ErrorRate: 0.5} },
+		steps: []breakerStep{
+			{code: RetCode(0x102), res: RetCode(0x102), state: BreakerClosed},
+			{code: RetCode(0x102), res: RetCode(0x102), state: BreakerClosed},
+		},
+	},
+	{
+		name: "successful probe closes breaker",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 1, ErrorRate: 0.5} },
+		steps: []breakerStep{
+			{code: RcIOError, res: RcIOError, state: BreakerOpen},
+			{code: RcOK, wait: true, res: RcOK, state: BreakerClosed},
+			{code: RcOK, res: RcOK, state: BreakerClosed},
+		},
+		transitions: "closed>open open>half-open half-open>closed",
+	},
+	{
+		name: "failed probe opens breaker again",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 1, ErrorRate: 0.5} },
+		steps: []breakerStep{
+			{code: RcIOError, res: RcIOError, state: BreakerOpen},
+			{code: RcIOError, wait: true, res: RcIOError, state: BreakerOpen},
+			{code: RcOK, res: RcCircuitOpen, state: BreakerOpen},
+		},
+		transitions: "closed>open open>half-open half-open>open",
+	},
+	{
+		name: "all probes should succeed",
+		cb:   func() *CircuitBreaker { return &CircuitBreaker{MinRequests: 1, ErrorRate: 0.5, HalfOpenRequests: 2} },
+		steps: []breakerStep{
+			{code: RcIOError, res: RcIOError, state: BreakerOpen},
+			{code: RcOK, wait: true, res: RcOK, state: BreakerHalfOpen},
+			{code: RcOK, res: RcOK, state: BreakerClosed},
+		},
+		transitions: "closed>open open>half-open half-open>closed",
+	},
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	for _, c := range breakerCases {
+		var code RetCode
+		var transitions string
+		cb := c.cb()
+		cb.OpenTimeout = testOpenTimeout
+		cb.Service = SF(func(r *Request) { r.Respond(code, nil) })
+		cb.OnStateChange = func(name string, from, to BreakerState) {
+			if transitions != "" {
+				transitions += " "
+			}
+			transitions += fmt.Sprintf("%v>%v", from, to)
+		}
+		for i, s := range c.steps {
+			if s.wait {
+				time.Sleep(testOpenTimeout * 3 / 2)
+			}
+			code = s.code
+			if res := CallMsgBody(cb, 1, Body(nil)); res.Code != s.res {
+				t.Errorf("%s: step %d answered with %x, want %x", c.name, i, res.Code, s.res)
+			}
+			if st := cb.State(); st != s.state {
+				t.Errorf("%s: step %d state %v, want %v", c.name, i, st, s.state)
+			}
+		}
+		if transitions != c.transitions {
+			t.Errorf("%s: transitions %q, want %q", c.name, transitions, c.transitions)
+		}
+	}
+}
@@ -84,6 +84,13 @@ func (b *Buffer) push(r *Request) {
 	}
 }
 
+// Len returns number of requests waiting in buffer and in its channel
+func (b *Buffer) Len() int {
+	/* head never passes tail, so load head first: otherwise head loaded later could be ahead of tail */
+	head := atomic.LoadUint64(&b.head)
+	return len(b.ch) + int(atomic.LoadUint64(&b.tail)-head)
+}
+
 func (b *Buffer) close() {
 	select {
 	case b.set <- true:
@@ -95,7 +102,7 @@ func (b *Buffer) close() {
 func (b *Buffer) loop() {
 	for <-b.set {
 	Tiny:
-		for ; b.head < atomic.LoadUint64(&b.tail); b.head++ {
+		for ; b.head < atomic.LoadUint64(&b.tail); atomic.AddUint64(&b.head, 1) {
 			var ok bool
 			big := b.head / bufRow
 			row := b.hRow
@@ -0,0 +1,31 @@
+// Package example holds types encoded by code generated with iprotogen.
+package example
+
+//go:generate go run github.com/funny-falcon/go-iproto/cmd/iprotogen -type=Header,Message
+
+type Kind uint8
+
+type Header struct {
+	Kind  Kind
+	Flags uint16
+	Id    uint64 `iproto:"ber"`
+	Trace [4]byte
+	hops  int
+}
+
+type Message struct {
+	Head     Header
+	Route    Header   `iproto:"size(ber)"`
+	Name     string   `iproto:"size(ber)"`
+	Shards   []uint32 `iproto:"cnt(i32)"`
+	Scores   []float64
+	Deltas   []uint64 `iproto:"ber"`
+	Marks    []uint16 `iproto:"ber,size(i8)"`
+	Size     uint32   `iproto:"ber,size(ber)"`
+	Codes    [3]int16 `iproto:"cnt(i8)"`
+	Data     []byte   `iproto:"size(i16)"`
+	Note     string
+	Local    string `iproto:"skip"`
+	Reserved [0]uint32
+	Body     []uint16 `iproto:"size(no)"`
+}
@@ -0,0 +1,100 @@
+// Code generated by iprotogen. DO NOT EDIT.
+
+package example
+
+import "github.com/funny-falcon/go-iproto/marshal"
+
+// IWrite writes Header as marshal.Writer.Write does by reflection
+func (v Header) IWrite(w *marshal.Writer) {
+	w.Uint8(uint8(v.Kind))
+	w.Uint16(v.Flags)
+	w.Uint64var(v.Id)
+	w.Uint8sl(v.Trace[:])
+}
+
+// IRead reads Header as marshal.Reader.Read does by reflection
+func (v *Header) IRead(r *marshal.Reader) {
+	v.Kind = Kind(r.Uint8())
+	v.Flags = r.Uint16()
+	v.Id = r.Uint64var()
+	r.Uint8sl(v.Trace[:])
+}
+
+// IWrite writes Message as marshal.Writer.Write does by reflection
+func (v Message) IWrite(w *marshal.Writer) {
+	v.Head.IWrite(w)
+	w.WriteSized((*marshal.Writer).Intvar, func(w *marshal.Writer) {
+		v.Route.IWrite(w)
+	})
+	w.Intvar(len(v.Name))
+	w.String(v.Name)
+	w.IntUint32(len(v.Shards))
+	w.Uint32sl(v.Shards)
+	w.IntUint32(len(v.Scores))
+	w.Float64sl(v.Scores)
+	w.IntUint32(len(v.Deltas))
+	for _, x := range v.Deltas {
+		w.Uint64var(x)
+	}
+	w.WriteSized((*marshal.Writer).IntUint8, func(w *marshal.Writer) {
+		for _, x := range v.Marks {
+			w.Uint64var(uint64(x))
+		}
+	})
+	w.Intvar(marshal.Uint64varSize(uint64(v.Size)))
+	w.Uint64var(uint64(v.Size))
+	w.IntUint8(3)
+	w.Int16sl(v.Codes[:])
+	w.IntUint16(len(v.Data))
+	w.Bytes(v.Data)
+	w.IntUint32(len(v.Note))
+	w.String(v.Note)
+	w.Uint16sl(v.Body)
+}
+
+// IRead reads Message as marshal.Reader.Read does by reflection
+func (v *Message) IRead(r *marshal.Reader) {
+	v.Head.IRead(r)
+	r.ReadSized((*marshal.Reader).Intvar, func(r *marshal.Reader) {
+		v.Route.IRead(r)
+	})
+	v.Name = r.String(r.Intvar())
+	if n := r.IntUint32(); r.CheckCount(n, 4) {
+		if len(v.Shards) != n {
+			v.Shards = make([]uint32, n)
+		}
+		r.Uint32sl(v.Shards)
+	}
+	if n := r.IntUint32(); r.CheckCount(n, 8) {
+		if len(v.Scores) != n {
+			v.Scores = make([]float64, n)
+		}
+		r.Float64sl(v.Scores)
+	}
+	if n := r.IntUint32(); r.CheckCount(n, 1) {
+		if len(v.Deltas) != n {
+			v.Deltas = make([]uint64, n)
+		}
+		for m := range v.Deltas {
+			v.Deltas[m] = r.Uint64var()
+		}
+	}
+	r.ReadSized((*marshal.Reader).IntUint8, func(r *marshal.Reader) {
+		v.Marks = v.Marks[:0]
+		for len(r.Body) > 0 && r.Err == nil {
+			v.Marks = append(v.Marks, uint16(r.Uint64var()))
+		}
+	})
+	r.ReadSized((*marshal.Reader).Intvar, func(r *marshal.Reader) {
+		v.Size = uint32(r.Uint64var())
+	})
+	if r.ExpectSize(r.IntUint8(), 3) {
+		r.Int16sl(v.Codes[:])
+	}
+	v.Data = r.Slice(r.IntUint16())
+	v.Note = r.String(r.IntUint32())
+	if r.Err == nil {
+		v.Body = make([]uint16, len(r.Body)/2)
+		r.Uint16sl(v.Body)
+	}
+}
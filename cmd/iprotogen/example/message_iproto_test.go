@@ -0,0 +1,105 @@
+// Code generated by iprotogen. DO NOT EDIT.
+
+package example
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+func TestIprotogenHeader(t *testing.T) {
+	type reflected Header
+	v := iprotogenSampleHeader(1)
+	var gen, ref marshal.Writer
+	gen.Write(v)
+	ref.Write(reflected(v))
+	b := gen.Written()
+	if !bytes.Equal(b, ref.Written()) {
+		t.Fatalf("generated and reflected encodings differ\ngen [% x]\nref [% x]", b, ref.Written())
+	}
+	var gv Header
+	if err := marshal.Read(b, &gv); err != nil || !reflect.DeepEqual(gv, v) {
+		t.Errorf("generated decoder: %+v %v", gv, err)
+	}
+	var rv reflected
+	if err := marshal.Read(b, &rv); err != nil || !reflect.DeepEqual(Header(rv), v) {
+		t.Errorf("reflected decoder: %+v %v", rv, err)
+	}
+	/* truncated body should not panic */
+	for n := range b {
+		var gv Header
+		marshal.Read(b[:n], &gv)
+	}
+}
+
+func iprotogenSampleHeader(seed int) (v Header) {
+	v.Kind = Kind(seed + 0)
+	v.Flags = uint16(seed + 1)
+	v.Id = uint64(128 + seed + 2)
+	for m := range v.Trace {
+		v.Trace[m] = uint8(seed + 3 + m)
+	}
+	return
+}
+
+func TestIprotogenMessage(t *testing.T) {
+	type reflected Message
+	v := iprotogenSampleMessage(1)
+	var gen, ref marshal.Writer
+	gen.Write(v)
+	ref.Write(reflected(v))
+	b := gen.Written()
+	if !bytes.Equal(b, ref.Written()) {
+		t.Fatalf("generated and reflected encodings differ\ngen [% x]\nref [% x]", b, ref.Written())
+	}
+	var gv Message
+	if err := marshal.Read(b, &gv); err != nil || !reflect.DeepEqual(gv, v) {
+		t.Errorf("generated decoder: %+v %v", gv, err)
+	}
+	var rv reflected
+	if err := marshal.Read(b, &rv); err != nil || !reflect.DeepEqual(Message(rv), v) {
+		t.Errorf("reflected decoder: %+v %v", rv, err)
+	}
+	/* truncated body should not panic */
+	for n := range b {
+		var gv Message
+		marshal.Read(b[:n], &gv)
+	}
+}
+
+func iprotogenSampleMessage(seed int) (v Message) {
+	v.Head = iprotogenSampleHeader(seed + 0)
+	v.Route = iprotogenSampleHeader(seed + 1)
+	v.Name = "s" + strconv.Itoa(seed+2)
+	v.Shards = make([]uint32, 2)
+	for m := range v.Shards {
+		v.Shards[m] = uint32(seed + 3 + m)
+	}
+	v.Scores = make([]float64, 2)
+	for m := range v.Scores {
+		v.Scores[m] = float64(seed + 4 + m)
+	}
+	v.Deltas = make([]uint64, 2)
+	for m := range v.Deltas {
+		v.Deltas[m] = uint64(128 + seed + 5 + m)
+	}
+	v.Marks = make([]uint16, 2)
+	for m := range v.Marks {
+		v.Marks[m] = uint16(128 + seed + 6 + m)
+	}
+	v.Size = uint32(128 + seed + 7)
+	for m := range v.Codes {
+		v.Codes[m] = int16(seed + 8 + m)
+	}
+	v.Data = []byte("b" + strconv.Itoa(seed+9))
+	v.Note = "s" + strconv.Itoa(seed+10)
+	v.Body = make([]uint16, 2)
+	for m := range v.Body {
+		v.Body[m] = uint16(seed + 11 + m)
+	}
+	return
+}
@@ -0,0 +1,25 @@
+package example
+
+//go:generate go run github.com/funny-falcon/go-iproto/cmd/iprotogen -sbox -type=User,Counter
+
+type User struct {
+	Id     uint32
+	Name   string
+	Email  []byte
+	Score  float64
+	Visits uint64 `iproto:"ber"`
+	Geo    [2]float32
+	Tags   []string `sbox:"tail"`
+}
+
+type Point struct {
+	At    uint32
+	Value int64
+	Label string
+}
+
+type Counter struct {
+	Key    string
+	Total  int64
+	Points []Point `sbox:"tailsplit"`
+}
@@ -0,0 +1,118 @@
+// Code generated by iprotogen. DO NOT EDIT.
+
+package example
+
+import "github.com/funny-falcon/go-iproto/marshal"
+
+// IWriteTuple writes User as sbox.WriteTuple does by reflection
+func (v User) IWriteTuple(w *marshal.Writer) {
+	w.IntUint32(6 + len(v.Tags))
+	w.Intvar(4)
+	w.Uint32(v.Id)
+	w.Intvar(len(v.Name))
+	w.String(v.Name)
+	w.Intvar(len(v.Email))
+	w.Bytes(v.Email)
+	w.Intvar(8)
+	w.Float64(v.Score)
+	w.Intvar(marshal.Uint64varSize(v.Visits))
+	w.Uint64var(v.Visits)
+	w.Intvar(8)
+	w.Float32sl(v.Geo[:])
+	for i := range v.Tags {
+		w.Intvar(len(v.Tags[i]))
+		w.String(v.Tags[i])
+	}
+}
+
+// IReadTuple reads User as sbox.ReadRawTuple does by reflection
+func (v *User) IReadTuple(r *marshal.Reader) {
+	l := r.IntUint32()
+	if l >= 6 {
+		if n := l - 6; len(v.Tags) != n && r.CheckCount(n, 1) {
+			v.Tags = make([]string, n)
+		}
+	}
+	for i := 0; i < l && i < 6; i++ {
+		switch i {
+		case 0:
+			if r.ExpectSize(r.Intvar(), 4) {
+				v.Id = r.Uint32()
+			}
+		case 1:
+			v.Name = r.String(r.Intvar())
+		case 2:
+			v.Email = r.Slice(r.Intvar())
+		case 3:
+			if r.ExpectSize(r.Intvar(), 8) {
+				v.Score = r.Float64()
+			}
+		case 4:
+			r.ReadSized((*marshal.Reader).Intvar, func(r *marshal.Reader) {
+				v.Visits = r.Uint64var()
+			})
+		case 5:
+			if r.ExpectSize(r.Intvar(), 8) {
+				r.Float32sl(v.Geo[:])
+			}
+		}
+	}
+	for i := 0; i < len(v.Tags) && 6+i < l; i++ {
+		v.Tags[i] = r.String(r.Intvar())
+	}
+}
+
+// IWriteTuple writes Counter as sbox.WriteTuple does by reflection
+func (v Counter) IWriteTuple(w *marshal.Writer) {
+	w.IntUint32(2 + len(v.Points)*3)
+	w.Intvar(len(v.Key))
+	w.String(v.Key)
+	w.Intvar(8)
+	w.Int64(v.Total)
+	for i := range v.Points {
+		el := &v.Points[i]
+		w.Intvar(4)
+		w.Uint32(el.At)
+		w.Intvar(8)
+		w.Int64(el.Value)
+		w.Intvar(len(el.Label))
+		w.String(el.Label)
+	}
+}
+
+// IReadTuple reads Counter as sbox.ReadRawTuple does by reflection
+func (v *Counter) IReadTuple(r *marshal.Reader) {
+	l := r.IntUint32()
+	if l >= 2 {
+		if n := (l - 2) / 3; len(v.Points) != n && r.CheckCount(n, 3) {
+			v.Points = make([]Point, n)
+		}
+	}
+	for i := 0; i < l && i < 2; i++ {
+		switch i {
+		case 0:
+			v.Key = r.String(r.Intvar())
+		case 1:
+			if r.ExpectSize(r.Intvar(), 8) {
+				v.Total = r.Int64()
+			}
+		}
+	}
+	for i := 0; i < len(v.Points) && 2+i*3 < l; i++ {
+		el := &v.Points[i]
+		for j := 0; j < 3 && 2+i*3+j < l; j++ {
+			switch j {
+			case 0:
+				if r.ExpectSize(r.Intvar(), 4) {
+					el.At = r.Uint32()
+				}
+			case 1:
+				if r.ExpectSize(r.Intvar(), 8) {
+					el.Value = r.Int64()
+				}
+			case 2:
+				el.Label = r.String(r.Intvar())
+			}
+		}
+	}
+}
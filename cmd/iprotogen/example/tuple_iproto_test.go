@@ -0,0 +1,92 @@
+// Code generated by iprotogen. DO NOT EDIT.
+
+package example
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+func TestIprotogenUser(t *testing.T) {
+	type reflected User
+	v := iprotogenSampleUser(1)
+	var gen, ref marshal.Writer
+	sbox.WriteTuple(&gen, v)
+	sbox.WriteTuple(&ref, reflected(v))
+	b := gen.Written()
+	if !bytes.Equal(b, ref.Written()) {
+		t.Fatalf("generated and reflected encodings differ\ngen [% x]\nref [% x]", b, ref.Written())
+	}
+	var gv User
+	if err := sbox.ReadRawTuple(&marshal.Reader{Body: b}, &gv); err != nil || !reflect.DeepEqual(gv, v) {
+		t.Errorf("generated decoder: %+v %v", gv, err)
+	}
+	var rv reflected
+	if err := sbox.ReadRawTuple(&marshal.Reader{Body: b}, &rv); err != nil || !reflect.DeepEqual(User(rv), v) {
+		t.Errorf("reflected decoder: %+v %v", rv, err)
+	}
+	/* truncated body should not panic */
+	for n := range b {
+		var gv User
+		sbox.ReadRawTuple(&marshal.Reader{Body: b[:n]}, &gv)
+	}
+}
+
+func iprotogenSampleUser(seed int) (v User) {
+	v.Id = uint32(seed + 0)
+	v.Name = "s" + strconv.Itoa(seed+1)
+	v.Email = []byte("b" + strconv.Itoa(seed+2))
+	v.Score = float64(seed + 3)
+	v.Visits = uint64(128 + seed + 4)
+	for m := range v.Geo {
+		v.Geo[m] = float32(seed + 5 + m)
+	}
+	v.Tags = make([]string, 2)
+	for i := range v.Tags {
+		v.Tags[i] = "s" + strconv.Itoa(seed+6+i)
+	}
+	return
+}
+
+func TestIprotogenCounter(t *testing.T) {
+	type reflected Counter
+	v := iprotogenSampleCounter(1)
+	var gen, ref marshal.Writer
+	sbox.WriteTuple(&gen, v)
+	sbox.WriteTuple(&ref, reflected(v))
+	b := gen.Written()
+	if !bytes.Equal(b, ref.Written()) {
+		t.Fatalf("generated and reflected encodings differ\ngen [% x]\nref [% x]", b, ref.Written())
+	}
+	var gv Counter
+	if err := sbox.ReadRawTuple(&marshal.Reader{Body: b}, &gv); err != nil || !reflect.DeepEqual(gv, v) {
+		t.Errorf("generated decoder: %+v %v", gv, err)
+	}
+	var rv reflected
+	if err := sbox.ReadRawTuple(&marshal.Reader{Body: b}, &rv); err != nil || !reflect.DeepEqual(Counter(rv), v) {
+		t.Errorf("reflected decoder: %+v %v", rv, err)
+	}
+	/* truncated body should not panic */
+	for n := range b {
+		var gv Counter
+		sbox.ReadRawTuple(&marshal.Reader{Body: b[:n]}, &gv)
+	}
+}
+
+func iprotogenSampleCounter(seed int) (v Counter) {
+	v.Key = "s" + strconv.Itoa(seed+0)
+	v.Total = int64(seed + 1)
+	v.Points = make([]Point, 2)
+	for i := range v.Points {
+		el := &v.Points[i]
+		el.At = uint32(seed + 2 + i + 0)
+		el.Value = int64(seed + 2 + i + 1)
+		el.Label = "s" + strconv.Itoa(seed+2+i+2)
+	}
+	return
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+)
+
+const header = "// Code generated by iprotogen. DO NOT EDIT.\n\n"
+
+var widths = map[string]string{
+	"ber": "Intvar",
+	"i8":  "IntUint8",
+	"i16": "IntUint16",
+	"i32": "IntUint32",
+	"i64": "IntUint64",
+}
+
+type gen struct {
+	bytes.Buffer
+	p *pkg
+	/* strconv is set when test samples need it */
+	strconv bool
+}
+
+func (g *gen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g, format, args...)
+}
+
+/* method is a name of marshal.Writer and marshal.Reader method for basic type */
+func method(basic string) string {
+	return strings.ToUpper(basic[:1]) + basic[1:]
+}
+
+func plus(n int, s string) string {
+	if n == 0 {
+		return s
+	}
+	return fmt.Sprintf("%d+%s", n, s)
+}
+
+/* generate returns source of methods for types and of their round-trip tests */
+func generate(dir string, names []string, sbox bool) (code, test []byte, err error) {
+	p, err := parsePackage(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.sbox = sbox
+	for _, name := range names {
+		p.generated[name] = true
+	}
+	fields := make([][]*field, len(names))
+	for i, name := range names {
+		if fields[i], err = p.fields(name); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	g := &gen{p: p}
+	g.printf("%spackage %s\n\nimport \"github.com/funny-falcon/go-iproto/marshal\"\n", header, p.name)
+	for i, name := range names {
+		if sbox {
+			g.tupleWriter(name, fields[i])
+			g.tupleReader(name, fields[i])
+		} else {
+			g.writer(name, fields[i])
+			g.reader(name, fields[i])
+		}
+	}
+	if code, err = format.Source(g.Bytes()); err != nil {
+		return nil, nil, fmt.Errorf("format generated code: %v\n%s", err, g.Bytes())
+	}
+
+	t := &gen{p: p}
+	for i, name := range names {
+		t.test(name, fields[i])
+	}
+	g.Reset()
+	g.printf("%spackage %s\n\nimport (\n\"bytes\"\n\"reflect\"\n", header, p.name)
+	if t.strconv {
+		g.printf("\"strconv\"\n")
+	}
+	g.printf("\"testing\"\n\n\"github.com/funny-falcon/go-iproto/marshal\"\n")
+	if sbox {
+		g.printf("\"github.com/funny-falcon/go-iproto/sbox\"\n")
+	}
+	g.printf(")\n")
+	g.Write(t.Bytes())
+	if test, err = format.Source(g.Bytes()); err != nil {
+		return nil, nil, fmt.Errorf("format generated test: %v\n%s", err, g.Bytes())
+	}
+	return code, test, nil
+}
+
+func (g *gen) writer(name string, fields []*field) {
+	g.printf("\n// IWrite writes %s as marshal.Writer.Write does by reflection\n", name)
+	g.printf("func (v %s) IWrite(w *marshal.Writer) {\n", name)
+	for _, f := range fields {
+		g.writeField("v."+f.name, f.t, f.ber, f.dir, f.wr)
+	}
+	g.printf("}\n")
+}
+
+func (g *gen) reader(name string, fields []*field) {
+	g.printf("\n// IRead reads %s as marshal.Reader.Read does by reflection\n", name)
+	g.printf("func (v *%s) IRead(r *marshal.Reader) {\n", name)
+	for _, f := range fields {
+		g.readField("v."+f.name, f.t, f.ber, f.dir, f.wr)
+	}
+	g.printf("}\n")
+}
+
+/* splitTail returns fixed fields and sbox tail field, if any */
+func splitTail(fields []*field) ([]*field, *field) {
+	if n := len(fields); n > 0 && (fields[n-1].tail || fields[n-1].tailsplit) {
+		return fields[:n-1], fields[n-1]
+	}
+	return fields, nil
+}
+
+func (g *gen) tupleWriter(name string, fields []*field) {
+	fixed, tail := splitTail(fields)
+	nfix := len(fixed)
+	g.printf("\n// IWriteTuple writes %s as sbox.WriteTuple does by reflection\n", name)
+	g.printf("func (v %s) IWriteTuple(w *marshal.Writer) {\n", name)
+	switch {
+	case tail == nil:
+		g.printf("w.IntUint32(%d)\n", nfix)
+	case tail.tail:
+		g.printf("w.IntUint32(%s)\n", plus(nfix, "len(v."+tail.name+")"))
+	default:
+		g.printf("w.IntUint32(%s)\n", plus(nfix, fmt.Sprintf("len(v.%s)*%d", tail.name, len(tail.split))))
+	}
+	for _, f := range fixed {
+		g.writeField("v."+f.name, f.t, f.ber, "size", "ber")
+	}
+	switch {
+	case tail == nil:
+	case tail.tail:
+		g.printf("for i := range v.%s {\n", tail.name)
+		g.writeField(fmt.Sprintf("v.%s[i]", tail.name), tail.elem, false, "size", "ber")
+		g.printf("}\n")
+	default:
+		g.printf("for i := range v.%s {\nel := &v.%[1]s[i]\n", tail.name)
+		for _, f := range tail.split {
+			g.writeField("el."+f.name, f.t, f.ber, "size", "ber")
+		}
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+func (g *gen) tupleReader(name string, fields []*field) {
+	fixed, tail := splitTail(fields)
+	nfix := len(fixed)
+	g.printf("\n// IReadTuple reads %s as sbox.ReadRawTuple does by reflection\n", name)
+	g.printf("func (v *%s) IReadTuple(r *marshal.Reader) {\n", name)
+	g.printf("l := r.IntUint32()\n")
+	if tail != nil {
+		k := 1
+		if tail.tailsplit {
+			k = len(tail.split)
+		}
+		n := "l"
+		if nfix > 0 {
+			g.printf("if l >= %d {\n", nfix)
+			n = fmt.Sprintf("l - %d", nfix)
+			if k > 1 {
+				n = "(" + n + ")"
+			}
+		}
+		if k > 1 {
+			n = fmt.Sprintf("%s / %d", n, k)
+		}
+		g.printf("if n := %s; len(v.%s) != n && r.CheckCount(n, %d) {\n", n, tail.name, k)
+		g.printf("v.%s = make(%s, n)\n}\n", tail.name, tail.t.name)
+		if nfix > 0 {
+			g.printf("}\n")
+		}
+	}
+	if nfix > 0 {
+		g.printf("for i := 0; i < l && i < %d; i++ {\nswitch i {\n", nfix)
+		for i, f := range fixed {
+			g.printf("case %d:\n", i)
+			g.readField("v."+f.name, f.t, f.ber, "size", "ber")
+		}
+		g.printf("}\n}\n")
+	}
+	switch {
+	case tail == nil:
+	case tail.tail:
+		g.printf("for i := 0; i < len(v.%s) && %s < l; i++ {\n", tail.name, plus(nfix, "i"))
+		g.readField(fmt.Sprintf("v.%s[i]", tail.name), tail.elem, false, "size", "ber")
+		g.printf("}\n")
+	default:
+		k := len(tail.split)
+		g.printf("for i := 0; i < len(v.%s) && %s < l; i++ {\nel := &v.%[1]s[i]\n", tail.name, plus(nfix, fmt.Sprintf("i*%d", k)))
+		g.printf("for j := 0; j < %d && %s < l; j++ {\nswitch j {\n", k, plus(nfix, fmt.Sprintf("i*%d+j", k)))
+		for j, f := range tail.split {
+			g.printf("case %d:\n", j)
+			g.readField("el."+f.name, f.t, f.ber, "size", "ber")
+		}
+		g.printf("}\n}\n}\n")
+	}
+	g.printf("}\n")
+}
+
+/* writeRaw writes value without size or count */
+func (g *gen) writeRaw(x string, t *typ, ber bool) {
+	switch t.kind {
+	case kScalar:
+		switch {
+		case ber:
+			g.printf("w.Uint64var(%s)\n", u64(x, t))
+		case t.named:
+			g.printf("w.%s(%s(%s))\n", method(t.basic), t.basic, x)
+		default:
+			g.printf("w.%s(%s)\n", method(t.basic), x)
+		}
+	case kString:
+		if t.named {
+			x = "string(" + x + ")"
+		}
+		g.printf("w.String(%s)\n", x)
+	case kBytes:
+		g.printf("w.Bytes(%s)\n", x)
+	case kSlice:
+		if ber {
+			g.printf("for _, x := range %s {\nw.Uint64var(%s)\n}\n", x, u64("x", t))
+		} else {
+			g.printf("w.%ssl(%s)\n", method(t.basic), x)
+		}
+	case kArray:
+		g.printf("w.%ssl(%s[:])\n", method(t.basic), x)
+	case kStruct:
+		g.printf("%s.IWrite(w)\n", x)
+	}
+}
+
+/* u64 converts scalar or element of slice x to uint64 for varint */
+func u64(x string, t *typ) string {
+	if t.basic == "uint64" && !t.named {
+		return x
+	}
+	return "uint64(" + x + ")"
+}
+
+/* sizeOf is an expression of size written by writeRaw, or "" if it is known only after writing */
+func sizeOf(x string, t *typ, ber bool) string {
+	switch t.kind {
+	case kScalar:
+		if ber {
+			return fmt.Sprintf("marshal.Uint64varSize(%s)", u64(x, t))
+		}
+		return strconv.Itoa(t.size)
+	case kString, kBytes:
+		return "len(" + x + ")"
+	case kSlice:
+		if ber {
+			return ""
+		} else if t.size == 1 {
+			return "len(" + x + ")"
+		}
+		return fmt.Sprintf("len(%s)*%d", x, t.size)
+	case kArray:
+		return strconv.Itoa(t.n * t.size)
+	}
+	return ""
+}
+
+func countOf(x string, t *typ) string {
+	switch t.kind {
+	case kArray:
+		return strconv.Itoa(t.n)
+	case kString, kBytes, kSlice:
+		return "len(" + x + ")"
+	}
+	return "1"
+}
+
+func (g *gen) writeField(x string, t *typ, ber bool, dir, wr string) {
+	switch dir {
+	case "size":
+		if sz := sizeOf(x, t, ber); sz != "" {
+			g.printf("w.%s(%s)\n", widths[wr], sz)
+			g.writeRaw(x, t, ber)
+		} else {
+			g.printf("w.WriteSized((*marshal.Writer).%s, func(w *marshal.Writer) {\n", widths[wr])
+			g.writeRaw(x, t, ber)
+			g.printf("})\n")
+		}
+	case "cnt":
+		g.printf("w.%s(%s)\n", widths[wr], countOf(x, t))
+		g.writeRaw(x, t, ber)
+	case "no":
+		g.writeRaw(x, t, ber)
+	default:
+		switch t.kind {
+		case kString, kBytes, kSlice:
+			g.printf("w.IntUint32(len(%s))\n", x)
+		}
+		g.writeRaw(x, t, ber)
+	}
+}
+
+/* readRaw reads value which size or count is already known */
+func (g *gen) readRaw(x string, t *typ, ber bool) {
+	switch t.kind {
+	case kScalar:
+		switch {
+		case ber && t.name == "uint64":
+			g.printf("%s = r.Uint64var()\n", x)
+		case ber:
+			g.printf("%s = %s(r.Uint64var())\n", x, t.name)
+		case t.named:
+			g.printf("%s = %s(r.%s())\n", x, t.name, method(t.basic))
+		default:
+			g.printf("%s = r.%s()\n", x, method(t.basic))
+		}
+	case kSlice:
+		if ber {
+			g.printf("for m := range %s {\n%[1]s[m] = %s\n}\n", x, berElem(t))
+		} else {
+			g.printf("r.%ssl(%s)\n", method(t.basic), x)
+		}
+	case kArray:
+		g.printf("r.%ssl(%s[:])\n", method(t.basic), x)
+	case kStruct:
+		g.printf("%s.IRead(r)\n", x)
+	}
+}
+
+func berElem(t *typ) string {
+	if t.basic == "uint64" {
+		return "r.Uint64var()"
+	}
+	return t.basic + "(r.Uint64var())"
+}
+
+/* readTail reads value which consumes the rest of body */
+func (g *gen) readTail(x string, t *typ, ber bool) {
+	switch {
+	case t.kind == kString:
+		g.printf("%s = %s(r.Tail())\n", x, t.name)
+	case t.kind == kBytes:
+		g.printf("%s = r.Tail()\n", x)
+	case t.kind == kSlice && ber:
+		g.printf("%s = %[1]s[:0]\nfor len(r.Body) > 0 && r.Err == nil {\n%[1]s = append(%[1]s, %s)\n}\n", x, berElem(t))
+	case t.kind == kSlice:
+		g.printf("if r.Err == nil {\n%s = make(%s, len(r.Body)/%d)\n", x, t.name, t.size)
+		g.readRaw(x, t, ber)
+		g.printf("}\n")
+	default:
+		g.readRaw(x, t, ber)
+	}
+}
+
+func (g *gen) readString(x string, t *typ, n string) {
+	switch {
+	case t.kind == kBytes:
+		g.printf("%s = r.Slice(%s)\n", x, n)
+	case t.named:
+		g.printf("%s = %s(r.String(%s))\n", x, t.name, n)
+	default:
+		g.printf("%s = r.String(%s)\n", x, n)
+	}
+}
+
+/* readSlice reads n elements of slice, n is checked to fit the rest of body */
+func (g *gen) readSlice(x string, t *typ, ber bool, n string) {
+	elemSize := t.size
+	if ber {
+		elemSize = 1
+	}
+	g.printf("if n := %s; r.CheckCount(n, %d) {\n", n, elemSize)
+	g.printf("if len(%s) != n {\n%[1]s = make(%s, n)\n}\n", x, t.name)
+	g.readRaw(x, t, ber)
+	g.printf("}\n")
+}
+
+func (g *gen) readField(x string, t *typ, ber bool, dir, wr string) {
+	rd := "r." + widths[wr] + "()"
+	switch dir {
+	case "size":
+		switch {
+		case t.kind == kString || t.kind == kBytes:
+			g.readString(x, t, rd)
+		case t.kind == kScalar && !ber || t.kind == kArray:
+			g.printf("if r.ExpectSize(%s, %s) {\n", rd, sizeOf(x, t, ber))
+			g.readRaw(x, t, ber)
+			g.printf("}\n")
+		case t.kind == kSlice && !ber:
+			if t.size > 1 {
+				rd = fmt.Sprintf("%s / %d", rd, t.size)
+			}
+			g.readSlice(x, t, ber, rd)
+		default:
+			g.printf("r.ReadSized((*marshal.Reader).%s, func(r *marshal.Reader) {\n", widths[wr])
+			g.readTail(x, t, ber)
+			g.printf("})\n")
+		}
+	case "cnt":
+		switch t.kind {
+		case kString, kBytes:
+			g.readString(x, t, rd)
+		case kSlice:
+			g.readSlice(x, t, ber, rd)
+		default:
+			g.printf("if r.ExpectSize(%s, %s) {\n", rd, countOf(x, t))
+			g.readRaw(x, t, ber)
+			g.printf("}\n")
+		}
+	case "no":
+		g.readTail(x, t, ber)
+	default:
+		switch t.kind {
+		case kString, kBytes:
+			g.readString(x, t, "r.IntUint32()")
+		case kSlice:
+			g.readSlice(x, t, ber, "r.IntUint32()")
+		default:
+			g.readRaw(x, t, ber)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/* example package is generated with go:generate and committed, so generator should reproduce it */
+func TestGolden(t *testing.T) {
+	for _, c := range []struct {
+		file  string
+		types []string
+		sbox  bool
+	}{
+		{"message", []string{"Header", "Message"}, false},
+		{"tuple", []string{"User", "Counter"}, true},
+	} {
+		code, test, err := generate("example", c.types, c.sbox)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, got := range map[string][]byte{c.file + "_iproto.go": code, c.file + "_iproto_test.go": test} {
+			need, err := os.ReadFile(filepath.Join("example", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, need) {
+				t.Errorf("example/%s is stale, run go generate\n%s", name, got)
+			}
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		sbox bool
+	}{
+		{"type T struct{ A int }", false},
+		{"type T struct{ A *uint32 }", false},
+		{"type T struct{ A map[string]string }", false},
+		{"type T struct{ A uint32 `iproto:\"size(i32),cnt(i32)\"`}", false},
+		{"type T struct{ A []uint32 `iproto:\"size(no)\"`; B uint32 }", false},
+		{"type T struct{ A int32 `iproto:\"ber\"` }", false},
+		{"type T struct{ A uint32 `iproto:\"size(x)\"` }", false},
+		{"type T struct{ A U }; type U struct{ B uint32 }", false},
+		{"type T struct{ A []uint32 `sbox:\"tail\"`; B uint32 }", true},
+		{"type T struct{ A []U `sbox:\"tail\"` }; type U struct{ B uint32 }", true},
+		{"type T struct{ A U }; type U struct{ B uint32 }", true},
+		{"type T struct{ A []uint32 `iproto:\"ber\" sbox:\"tail\"` }", true},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "t.go"), []byte("package p\n"+c.src+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := generate(dir, []string{"T"}, c.sbox); err == nil {
+			t.Errorf("%s should fail", c.src)
+		}
+	}
+}
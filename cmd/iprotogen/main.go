@@ -0,0 +1,66 @@
+// Iprotogen generates encoders for structs in iproto format, without reflection.
+//
+// By default it generates IWrite and IRead methods, which marshal.Writer and marshal.Reader use instead
+// of reflection. With -sbox it generates IWriteTuple and IReadTuple methods used by sbox.WriteTuple
+// and sbox.ReadRawTuple. Struct tags are understood the same way as by reflection, and output is
+// byte-identical, which is checked by generated round-trip tests:
+//
+//	//go:generate go run github.com/funny-falcon/go-iproto/cmd/iprotogen -type=Request,Response
+//
+// Methods are written to <file>_iproto.go and tests to <file>_iproto_test.go, where <file> is a file
+// containing go:generate directive.
+//
+// Supported field types are sized integers and floats, strings, and slices and arrays of them, and
+// (without -sbox) structs which are generated at the same run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct types; must be set")
+	sbox      = flag.Bool("sbox", false, "generate sbox tuple encoders instead of marshal ones")
+	output    = flag.String("output", "", "output file name; default <file>_iproto.go")
+	test      = flag.Bool("test", true, "generate round-trip tests into <output>_test.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: iprotogen [flags] -type T[,T...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("iprotogen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output == "" {
+		gofile := os.Getenv("GOFILE")
+		if gofile == "" {
+			log.Fatalf("-output should be set when not run by go generate")
+		}
+		*output = strings.TrimSuffix(gofile, ".go") + "_iproto.go"
+	}
+
+	code, tests, err := generate(".", strings.Split(*typeNames, ","), *sbox)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.WriteFile(*output, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if *test {
+		if err = os.WriteFile(strings.TrimSuffix(*output, ".go")+"_test.go", tests, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	kScalar kind = iota
+	kString
+	kBytes
+	/* slice or array of scalars */
+	kSlice
+	kArray
+	/* struct of this package with generated methods */
+	kStruct
+)
+
+type typ struct {
+	kind kind
+	name string
+	/* named is true for defined types, which need conversion to and from basic */
+	named bool
+	/* basic type of scalar or of element */
+	basic string
+	size  int
+	n     int
+}
+
+type field struct {
+	name string
+	t    *typ
+	ber  bool
+	/* dir is "", "size", "cnt" or "no", wr is width of size or count */
+	dir string
+	wr  string
+	/* sbox tail: elem is type of element, split are fields of tailsplit element */
+	tail      bool
+	tailsplit bool
+	elem      *typ
+	split     []*field
+	splitType string
+}
+
+var basics = map[string]int{
+	"int8": 1, "uint8": 1, "byte": 1,
+	"int16": 2, "uint16": 2,
+	"int32": 4, "uint32": 4,
+	"int64": 8, "uint64": 8,
+	"float32": 4, "float64": 8,
+}
+
+type pkg struct {
+	name  string
+	types map[string]ast.Expr
+	/* generated is a set of types methods are generated for */
+	generated map[string]bool
+	sbox      bool
+}
+
+func parsePackage(dir string) (*pkg, error) {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expect one package in %s, found %d", dir, len(pkgs))
+	}
+	p := &pkg{types: make(map[string]ast.Expr), generated: make(map[string]bool)}
+	for name, ap := range pkgs {
+		p.name = name
+		files := make([]string, 0, len(ap.Files))
+		for f := range ap.Files {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			for _, decl := range ap.Files[f].Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					p.types[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *pkg) resolve(e ast.Expr, depth int) (*typ, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("type %s is too deep", types.ExprString(e))
+	}
+	switch t := e.(type) {
+	case *ast.Ident:
+		if sz, ok := basics[t.Name]; ok {
+			basic := t.Name
+			if basic == "byte" {
+				basic = "uint8"
+			}
+			return &typ{kind: kScalar, name: t.Name, basic: basic, size: sz}, nil
+		}
+		if t.Name == "string" {
+			return &typ{kind: kString, name: t.Name}, nil
+		}
+		def, ok := p.types[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %s", t.Name)
+		}
+		if _, ok := def.(*ast.StructType); ok {
+			return &typ{kind: kStruct, name: t.Name}, nil
+		}
+		under, err := p.resolve(def, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if under.kind != kScalar && under.kind != kString {
+			return nil, fmt.Errorf("unsupported type %s: use %s instead", t.Name, under.name)
+		}
+		res := *under
+		res.name, res.named = t.Name, true
+		return &res, nil
+	case *ast.ArrayType:
+		el, err := p.resolve(t.Elt, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if el.kind != kScalar || el.named {
+			return nil, fmt.Errorf("unsupported type %s: element should be a basic number", types.ExprString(e))
+		}
+		res := &typ{name: types.ExprString(e), basic: el.basic, size: el.size}
+		if t.Len == nil {
+			if el.basic == "uint8" {
+				res.kind = kBytes
+			} else {
+				res.kind = kSlice
+			}
+			return res, nil
+		}
+		lit, ok := t.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return nil, fmt.Errorf("unsupported array length in %s", types.ExprString(e))
+		}
+		n, err := strconv.Atoi(lit.Value)
+		if err != nil {
+			return nil, err
+		}
+		res.kind, res.n = kArray, n
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", types.ExprString(e))
+}
+
+func (p *pkg) structType(name string) (*ast.StructType, error) {
+	def, ok := p.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in package %s", name, p.name)
+	}
+	st, ok := def.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not a struct", name)
+	}
+	return st, nil
+}
+
+/* fields returns fields as marshal reflection sees them: exported, not skipped, not of zero size */
+func (p *pkg) fields(name string) ([]*field, error) {
+	st, err := p.structType(name)
+	if err != nil {
+		return nil, err
+	}
+	var res []*field
+	nosize, tail := false, false
+	for _, af := range st.Fields.List {
+		if len(af.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded fields are not supported", name)
+		}
+		var tag reflect.StructTag
+		if af.Tag != nil {
+			s, err := strconv.Unquote(af.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+	Names:
+		for _, n := range af.Names {
+			if !n.IsExported() {
+				continue
+			}
+			if nosize {
+				return nil, fmt.Errorf("%s: only last field could be marked as size(no) or cnt(no)", name)
+			}
+			if tail {
+				return nil, fmt.Errorf("%s: sbox tail could be only last field", name)
+			}
+			f := &field{name: n.Name}
+			for _, m := range strings.Split(tag.Get("iproto"), ",") {
+				var dir string
+				switch {
+				case m == "skip":
+					continue Names
+				case m == "ber":
+					f.ber = true
+				case strings.HasPrefix(m, "size(") && strings.HasSuffix(m, ")"):
+					dir, m = "size", m[5:len(m)-1]
+				case strings.HasPrefix(m, "cnt(") && strings.HasSuffix(m, ")"):
+					dir, m = "cnt", m[4:len(m)-1]
+				}
+				if dir == "" {
+					continue
+				}
+				if f.dir != "" {
+					return nil, fmt.Errorf("%s.%s: shall not use both size() and cnt()", name, f.name)
+				}
+				switch m {
+				case "ber", "i8", "i16", "i32", "i64":
+					f.dir, f.wr = dir, m
+				case "no":
+					f.dir = "no"
+					nosize = true
+				default:
+					return nil, fmt.Errorf("%s.%s: could not understand directive %s(%s)", name, f.name, dir, m)
+				}
+			}
+			if f.t, err = p.fieldType(name, f, af.Type, tag.Get("sbox")); err != nil {
+				return nil, err
+			}
+			if f.t.kind == kArray && f.t.n == 0 && f.dir != "size" && f.dir != "cnt" {
+				continue
+			}
+			tail = f.tail || f.tailsplit
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+func (p *pkg) fieldType(name string, f *field, e ast.Expr, sboxTag string) (*typ, error) {
+	if p.sbox {
+		for _, m := range strings.Split(sboxTag, ",") {
+			switch m {
+			case "tail":
+				f.tail = true
+			case "tailsplit":
+				f.tailsplit = true
+			}
+		}
+	}
+	if f.tail || f.tailsplit {
+		at, ok := e.(*ast.ArrayType)
+		if !ok || at.Len != nil {
+			return nil, fmt.Errorf("%s.%s: could apply sbox tail only for slices", name, f.name)
+		}
+		if f.ber {
+			return nil, fmt.Errorf("%s.%s: ber is not supported for sbox tail", name, f.name)
+		}
+		t := &typ{kind: kSlice, name: types.ExprString(e)}
+		if f.tail {
+			el, err := p.resolve(at.Elt, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, f.name, err)
+			}
+			if el.kind == kStruct {
+				return nil, fmt.Errorf("%s.%s: use tailsplit for slice of structs", name, f.name)
+			}
+			f.elem = el
+			return t, nil
+		}
+		id, ok := at.Elt.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: could apply sbox tailsplit only for slices of struct", name, f.name)
+		}
+		split, err := p.fields(id.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(split) == 0 {
+			return nil, fmt.Errorf("%s.%s: tailsplit element %s has no fields", name, f.name, id.Name)
+		}
+		for _, sf := range split {
+			if sf.tail || sf.tailsplit {
+				return nil, fmt.Errorf("%s.%s: nested sbox tail in %s", name, f.name, id.Name)
+			}
+		}
+		f.split, f.splitType = split, id.Name
+		return t, nil
+	}
+
+	t, err := p.resolve(e, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: %v", name, f.name, err)
+	}
+	if f.ber && (t.kind == kString || t.kind == kBytes || t.kind == kStruct || t.kind == kArray ||
+		!strings.HasPrefix(t.basic, "uint")) {
+		return nil, fmt.Errorf("%s.%s: could not apply ber for type %s", name, f.name, t.name)
+	}
+	if t.kind == kStruct {
+		if p.sbox {
+			return nil, fmt.Errorf("%s.%s: struct fields are not supported in tuples", name, f.name)
+		}
+		if !p.generated[t.name] {
+			return nil, fmt.Errorf("%s.%s: struct %s should be generated too", name, f.name, t.name)
+		}
+		if f.dir == "cnt" {
+			return nil, fmt.Errorf("%s.%s: could not apply cnt() for struct", name, f.name)
+		}
+	}
+	return t, nil
+}
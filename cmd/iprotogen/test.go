@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+)
+
+/* test emits round-trip test of type against reflection, and sample value to test it with */
+func (g *gen) test(name string, fields []*field) {
+	enc, dec := "%s.Write(%s)", "marshal.Read(%s, &%s)"
+	if g.p.sbox {
+		enc, dec = "sbox.WriteTuple(&%s, %s)", "sbox.ReadRawTuple(&marshal.Reader{Body: %s}, &%s)"
+	}
+	g.printf("\nfunc TestIprotogen%s(t *testing.T) {\n", name)
+	g.printf("type reflected %s\n", name)
+	g.printf("v := iprotogenSample%s(1)\n", name)
+	g.printf("var gen, ref marshal.Writer\n")
+	g.printf(enc+"\n", "gen", "v")
+	g.printf(enc+"\n", "ref", "reflected(v)")
+	g.printf("b := gen.Written()\n")
+	g.printf("if !bytes.Equal(b, ref.Written()) {\n")
+	g.printf("t.Fatalf(\"generated and reflected encodings differ\\ngen [%% x]\\nref [%% x]\", b, ref.Written())\n}\n")
+	g.printf("var gv %s\n", name)
+	g.printf("if err := "+dec+"; err != nil || !reflect.DeepEqual(gv, v) {\n", "b", "gv")
+	g.printf("t.Errorf(\"generated decoder: %%+v %%v\", gv, err)\n}\n")
+	g.printf("var rv reflected\n")
+	g.printf("if err := "+dec+"; err != nil || !reflect.DeepEqual(%s(rv), v) {\n", "b", "rv", name)
+	g.printf("t.Errorf(\"reflected decoder: %%+v %%v\", rv, err)\n}\n")
+	g.printf("/* truncated body should not panic */\n")
+	g.printf("for n := range b {\nvar gv %s\n"+dec+"\n}\n", name, "b[:n]", "gv")
+	g.printf("}\n")
+
+	g.printf("\nfunc iprotogenSample%s(seed int) (v %s) {\n", name, name)
+	for k, f := range fields {
+		x, seed := "v."+f.name, fmt.Sprintf("seed+%d", k)
+		switch {
+		case f.tail:
+			g.printf("%s = make(%s, 2)\nfor i := range %[1]s {\n", x, f.t.name)
+			g.sample(x+"[i]", f.elem, false, seed+"+i")
+			g.printf("}\n")
+		case f.tailsplit:
+			g.printf("%s = make(%s, 2)\nfor i := range %[1]s {\nel := &%[1]s[i]\n", x, f.t.name)
+			for j, sf := range f.split {
+				g.sample("el."+sf.name, sf.t, sf.ber, fmt.Sprintf("%s+i+%d", seed, j))
+			}
+			g.printf("}\n")
+		default:
+			g.sample(x, f.t, f.ber, seed)
+		}
+	}
+	g.printf("return\n}\n")
+}
+
+/* sample assigns value derived from seed to x; ber values are large enough to take two bytes */
+func (g *gen) sample(x string, t *typ, ber bool, seed string) {
+	if ber {
+		seed = "128+" + seed
+	}
+	switch t.kind {
+	case kScalar:
+		g.printf("%s = %s(%s)\n", x, t.name, seed)
+	case kString:
+		g.strconv = true
+		if t.named {
+			g.printf("%s = %s(\"s\" + strconv.Itoa(%s))\n", x, t.name, seed)
+		} else {
+			g.printf("%s = \"s\" + strconv.Itoa(%s)\n", x, seed)
+		}
+	case kBytes:
+		g.strconv = true
+		g.printf("%s = %s(\"b\" + strconv.Itoa(%s))\n", x, t.name, seed)
+	case kSlice, kArray:
+		if t.kind == kSlice {
+			g.printf("%s = make(%s, 2)\n", x, t.name)
+		}
+		g.printf("for m := range %s {\n%[1]s[m] = %s(%s + m)\n}\n", x, t.basic, seed)
+	case kStruct:
+		g.printf("%s = iprotogenSample%s(%s)\n", x, t.name, seed)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var _ = log.Print
@@ -56,6 +57,28 @@ type Context struct {
 	owngen    bool
 	gen       *RGenerator
 	cancelBuf []contextBookmark
+	deadline  Epoch
+}
+
+// SetDeadline limits time budget of context: requests created with NewRequest and NewMulti
+// will be expired not later than deadline. Earliest deadline wins.
+func (c *Context) SetDeadline(deadline Epoch) {
+	c.m.Lock()
+	if c.deadline.Zero() || deadline < c.deadline {
+		c.deadline = deadline
+	}
+	c.m.Unlock()
+}
+
+func (c *Context) SetTimeout(timeout time.Duration) {
+	c.SetDeadline(NowEpoch().Add(timeout))
+}
+
+// Deadline returns deadline of context, or zero Epoch if budget is unlimited
+func (c *Context) Deadline() Epoch {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.deadline
 }
 
 func (c *Context) RemoveCanceler(cn Canceler) {
@@ -147,9 +170,15 @@ func (c *Context) NewRequest(msg RequestType, body interface{}) (r *Request, res
 	res, r.Responder = ch, ch
 
 	rc := RetCode(atomic.LoadUint32((*uint32)(&c.State)))
+	deadline := c.Deadline()
 	if rc != 0 {
 		r.Cancel()
+	} else if !deadline.Zero() && deadline.Remains() <= 0 {
+		r.Expire()
 	} else {
+		if !deadline.Zero() {
+			r.SetTimeout(deadline.Remains())
+		}
 		if len(c.cancelBuf) == 0 {
 			c.cancelBuf = make([]contextBookmark, cxReqBuf)
 		}
@@ -169,9 +198,15 @@ func (c *Context) NewMulti() (multi *MultiRequest) {
 	}
 	multi = &MultiRequest{cx: c, gen: c.gen}
 	rc := RetCode(atomic.LoadUint32((*uint32)(&c.State)))
+	deadline := c.Deadline()
 	if rc != 0 {
 		multi.Cancel()
+	} else if !deadline.Zero() && deadline.Remains() <= 0 {
+		multi.Expire()
 	} else {
+		if !deadline.Zero() {
+			multi.SetTimeout(deadline.Remains())
+		}
 		c.AddCanceler(multi)
 	}
 	return multi
@@ -203,17 +238,17 @@ func (c *Context) Call(serv Service, r RequestData) *Response {
 }
 
 func (c *Context) Alive() bool {
-	return c.State == 0
+	return atomic.LoadUint32((*uint32)(&c.State)) == 0
 }
 
 func (c *Context) Timeout() bool {
-	return c.State == CxTimeout
+	return CxState(atomic.LoadUint32((*uint32)(&c.State))) == CxTimeout
 }
 
 func (c *Context) Child() (child *Context, ok bool) {
-	child = &Context{parent: c}
+	child = &Context{parent: c, deadline: c.Deadline()}
 	rc := CxState(atomic.LoadUint32((*uint32)(&c.State)))
-	if rc == 0 {
+	if ok = rc == 0; ok {
 		c.AddCanceler(child)
 	} else {
 		child.Cancel()
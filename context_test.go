@@ -0,0 +1,99 @@
+package iproto
+
+import (
+	"testing"
+	"time"
+)
+
+/* timeout is computed from remaining budget, so deadline may drift for a while it takes */
+func expectDeadline(t *testing.T, what string, got, want Epoch) {
+	if got.Zero() || got > want.Add(time.Millisecond) || got < want.Add(-10*time.Millisecond) {
+		t.Errorf("%s deadline %v, want %v", what, got.Time(), want.Time())
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	var cx Context
+	cx.SetTimeout(time.Hour)
+	cx.SetTimeout(50 * time.Millisecond)
+	dl := cx.Deadline()
+	cx.SetTimeout(time.Hour)
+	if cx.Deadline() != dl {
+		t.Errorf("later deadline overrides earlier one")
+	}
+
+	r, _ := cx.NewRequest(1, Body(nil))
+	expectDeadline(t, "request", r.Deadline(), dl)
+	multi := cx.NewMulti()
+	expectDeadline(t, "multi request", multi.deadline, dl)
+	multi.Results()
+	child, _ := cx.Child()
+	if child.Deadline() != dl {
+		t.Errorf("child deadline %v, want %v", child.Deadline().Time(), dl.Time())
+	}
+	child.Done()
+	cx.Cancel()
+}
+
+func TestContextExhausted(t *testing.T) {
+	var cx Context
+	cx.SetDeadline(NowEpoch().Add(-time.Millisecond))
+	_, res := cx.NewRequest(1, Body(nil))
+	if r := <-res; r.Code != RcTimeout {
+		t.Errorf("request of exhausted context answered with %x", r.Code)
+	}
+	multi := cx.NewMulti()
+	multi.Request(1, Body(nil))
+	if rs := multi.Results(); len(rs) != 1 || rs[0].Code != RcTimeout {
+		t.Errorf("multi request of exhausted context answered with %v", rs)
+	}
+}
+
+func TestReqContextDeadline(t *testing.T) {
+	req := &Request{Msg: 1, Responder: make(Chan, 1)}
+	req.SetTimeout(50 * time.Millisecond)
+	req.SetPending()
+	cx := req.Context()
+	if cx.Deadline() != req.Deadline() {
+		t.Errorf("request context deadline %v, want %v", cx.Deadline().Time(), req.Deadline().Time())
+	}
+	r, _ := cx.NewRequest(1, Body(nil))
+	expectDeadline(t, "nested request", r.Deadline(), req.Deadline())
+	cx.Done()
+}
+
+func TestContextGo(t *testing.T) {
+	var cx Context
+	ran := make(chan int, 4)
+	cx.Go(func(*Context) { ran <- 1 })
+	cx.GoInt(func(_ *Context, i interface{}) { ran <- i.(int) }, 2)
+	done := make(chan struct{})
+	cx.GoAsync(func(child *Context) {
+		ran <- 3
+		child.Done()
+	})
+	cx.GoIntAsync(func(child *Context, i interface{}) {
+		ran <- i.(int)
+		child.Done()
+		close(done)
+	}, 4)
+	<-done
+	cx.WaitAll()
+	sum := 0
+	for i := 0; i < 4; i++ {
+		sum += <-ran
+	}
+	if sum != 10 {
+		t.Errorf("not every callback is run")
+	}
+
+	cx.Cancel()
+	if child, ok := cx.Child(); ok || child.Alive() {
+		t.Errorf("child of canceled context is alive")
+	}
+	cx.Go(func(*Context) { ran <- 5 })
+	time.Sleep(5 * time.Millisecond)
+	if len(ran) != 0 {
+		t.Errorf("callback of canceled context is run")
+	}
+}
@@ -191,7 +191,7 @@ func main() {
 	self := serverConf.NewServer()
 	self.Run()
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, os.Kill)
 	<-ch
 
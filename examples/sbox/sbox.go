@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"reflect"
@@ -61,42 +63,37 @@ func main() {
 	box := client.ServerConfig{Address: "localhost:33010", Timeout: time.Second}.NewServer()
 	iproto.Run(box)
 
-	res := iproto.Call(box, sbox.StoreReq{Space: 0, Return: true, Tuple: tuple})
-	if res.Code != sbox.RcOK {
-		fmt.Printf("Store error: %x %s\n", res.Code, res.Body)
-		return
-	}
-	var c uint32
-	res.Body.Read(&c)
-	fmt.Printf("Store %d [% x]\n", c, res.Body)
+	cl := sbox.NewClient(box)
+	ctx := context.Background()
 
-	res = iproto.Call(box, sbox.SelectReq{Space: 0, Index: 0, Limit: -1, Keys: []int32{12345, 12345}})
-	if res.Code != sbox.RcOK {
-		fmt.Printf("Select error: %x %s\n", res.Code, res.Body)
+	var stored TStruct
+	if err := cl.Store(ctx, 0, tuple, &stored); err != nil {
+		fmt.Printf("Store error: %v\n", err)
 		return
 	}
+	fmt.Printf("Store %+v\n", stored)
+
 	var tuples []TStruct
-	if _, _, err := sbox.ReadMany(res.Body, &tuples); err != nil {
-		fmt.Printf("Select parse error: %v\n", err)
+	if err := cl.Select(ctx, 0, 0, []int32{12345, 12345}, &tuples); err != nil {
+		fmt.Printf("Select error: %v\n", err)
 		return
 	}
 	if !reflect.DeepEqual(tuple, tuples[0]) || !reflect.DeepEqual(tuple, tuples[1]) {
 		fmt.Printf("Not equal %+v %+v\n", tuple, tuples)
 	}
 
-	res = iproto.Call(box, sbox.SelectReq{Space: 0, Index: 1, Limit: -1, Keys: "hello@worl.d"})
-	if res.Code != sbox.RcOK {
-		fmt.Printf("Select error: %x %s\n", res.Code, res.Body)
-		return
-	}
-	if _, _, err := sbox.ReadMany(res.Body, &tuples); err != nil {
-		fmt.Printf("Select parse error: %v\n", err)
+	if err := cl.Select(ctx, 0, 1, "hello@worl.d", &tuples); err != nil {
+		fmt.Printf("Select error: %v\n", err)
 		return
 	}
 	if !reflect.DeepEqual(tuple, tuples[0]) {
 		fmt.Printf("Not equal %+v %+v\n", tuple, tuples[0])
 	}
 
+	if err := cl.Insert(ctx, 0, tuple, nil); errors.Is(err, sbox.ErrTupleExists) {
+		fmt.Printf("Insert of existing tuple: %v\n", err)
+	}
+
 	add := *n / *g
 	mod := *n % *g
 	if mod == 0 {
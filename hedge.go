@@ -0,0 +1,240 @@
+package iproto
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hedgeSamples   = 128
+	hedgeRecompute = 32
+)
+
+// DefaultHedgeDelay is used by HedgeService with zero Delay, so it does not duplicate every request at once
+var DefaultHedgeDelay = 100 * time.Millisecond
+
+// HedgeService sends request to Primary, and if no answer arrives during a hedge delay,
+// sends a duplicate to Secondary (or to Primary again, if Secondary is nil).
+// First successful response wins, the other request is canceled.
+//
+// Delay is either fixed Delay or, if Percentile is set (0 < Percentile < 1), observed
+// percentile of response latency. Delay is used until enough latency samples are collected.
+// DefaultHedgeDelay is used if Delay is not set.
+//
+// Original request never goes to child services: HedgeService takes it in fly and sends copies,
+// so bookmarks chained on original request (StatWrap, Context) see only final response.
+type HedgeService struct {
+	Primary    Service
+	Secondary  Service
+	Delay      time.Duration
+	Percentile float64
+
+	m        sync.Mutex
+	samples  [hedgeSamples]time.Duration
+	nsamples int
+	pDelay   int64
+
+	sent, hedged, won uint64
+}
+
+func (h *HedgeService) secondary() Service {
+	if h.Secondary != nil {
+		return h.Secondary
+	}
+	return h.Primary
+}
+
+func (h *HedgeService) DefaultTimeout() time.Duration {
+	return h.Primary.DefaultTimeout()
+}
+
+func (h *HedgeService) Runned() bool {
+	return h.Primary.Runned() && h.secondary().Runned()
+}
+
+// Stats returns number of requests sent, number of duplicates sent and number of times duplicate won
+func (h *HedgeService) Stats() (sent, hedged, won uint64) {
+	return atomic.LoadUint64(&h.sent), atomic.LoadUint64(&h.hedged), atomic.LoadUint64(&h.won)
+}
+
+func (h *HedgeService) delay() time.Duration {
+	if h.Percentile > 0 {
+		if d := atomic.LoadInt64(&h.pDelay); d > 0 {
+			return time.Duration(d)
+		}
+	}
+	if h.Delay <= 0 {
+		return DefaultHedgeDelay
+	}
+	return h.Delay
+}
+
+func (h *HedgeService) observe(d time.Duration) {
+	if h.Percentile <= 0 {
+		return
+	}
+	h.m.Lock()
+	h.samples[h.nsamples%hedgeSamples] = d
+	h.nsamples++
+	if h.nsamples%hedgeRecompute == 0 && h.nsamples >= hedgeSamples {
+		sorted := h.samples
+		sort.Slice(sorted[:], func(i, j int) bool { return sorted[i] < sorted[j] })
+		i := int(h.Percentile * hedgeSamples)
+		if i >= hedgeSamples {
+			i = hedgeSamples - 1
+		}
+		atomic.StoreInt64(&h.pDelay, int64(sorted[i]))
+	}
+	h.m.Unlock()
+}
+
+func (h *HedgeService) Send(r *Request) {
+	if !r.SetPending() {
+		return
+	}
+	hr := &hedgeRequest{
+		h:      h,
+		parent: r,
+		e:      NowEpoch(),
+		body:   append([]byte(nil), r.Body...),
+		winner: -1,
+	}
+	if !r.SetInFly(hr) {
+		return
+	}
+	atomic.AddUint64(&h.sent, 1)
+	hr.send(0)
+	hr.m.Lock()
+	if !hr.done {
+		hr.timer = time.AfterFunc(h.delay(), hr.hedge)
+	}
+	hr.m.Unlock()
+}
+
+func hedgeFailed(code RetCode) bool {
+	return code == RcIOError || code == RcTimeout || code == RcShutdown || code&RcKindMask == RcTemporary
+}
+
+type hedgeRequest struct {
+	Bookmark
+	h      *HedgeService
+	parent *Request
+	e      Epoch
+	body   Body
+
+	m        sync.Mutex
+	subs     [2]*Request
+	finished [2]bool
+	n        int
+	failed   int
+	done     bool
+	winner   int
+	timer    *time.Timer
+}
+
+type hedgeResponder struct {
+	hr *hedgeRequest
+	i  int
+}
+
+func (hs hedgeResponder) Respond(res *Response) {
+	hs.hr.respond(hs.i, res)
+}
+
+func (hr *hedgeRequest) send(i int) {
+	serv := hr.h.Primary
+	if i == 1 {
+		serv = hr.h.secondary()
+	}
+	parent := hr.parent
+	sub := &Request{
+		Msg:       parent.Msg,
+		Id:        parent.Id,
+		Body:      hr.body,
+		Responder: hedgeResponder{hr: hr, i: i},
+	}
+	if dl := parent.Deadline(); !dl.Zero() {
+		sub.SetTimeout(dl.Remains())
+	}
+	hr.m.Lock()
+	if hr.done {
+		hr.m.Unlock()
+		return
+	}
+	hr.subs[i] = sub
+	hr.n++
+	hr.m.Unlock()
+	serv.Send(sub)
+}
+
+func (hr *hedgeRequest) hedge() {
+	hr.m.Lock()
+	fire := !hr.done && hr.n == 1
+	hr.m.Unlock()
+	if fire {
+		atomic.AddUint64(&hr.h.hedged, 1)
+		hr.send(1)
+	}
+}
+
+func (hr *hedgeRequest) respond(i int, res *Response) {
+	hr.m.Lock()
+	hr.finished[i] = true
+	if hr.done {
+		hr.m.Unlock()
+		return
+	}
+	if hedgeFailed(res.Code) {
+		hr.failed++
+		if hr.n == 1 {
+			/* primary failed before duplicate were sent: send it right now */
+			hr.m.Unlock()
+			hr.hedge()
+			return
+		}
+		if hr.failed < hr.n {
+			hr.m.Unlock()
+			return
+		}
+	}
+	hr.done = true
+	hr.winner = i
+	timer := hr.timer
+	hr.m.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+	if !hedgeFailed(res.Code) {
+		hr.h.observe(hr.e.Elapsed())
+		if i == 1 {
+			atomic.AddUint64(&hr.h.won, 1)
+		}
+	}
+	hr.parent.RespondBytes(res.Code, res.Body)
+}
+
+// Respond is called when original request is performed, either by us or by cancel/expire
+func (hr *hedgeRequest) Respond(res *Response) {
+	hr.m.Lock()
+	hr.done = true
+	timer := hr.timer
+	var cancels [2]*Request
+	for i, sub := range hr.subs {
+		if sub != nil && !hr.finished[i] && i != hr.winner {
+			cancels[i] = sub
+		}
+	}
+	hr.m.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+	for _, sub := range cancels {
+		if sub != nil {
+			sub.Cancel()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package iproto
+
+import (
+	"testing"
+	"time"
+)
+
+func holdService(held chan *Request) SF {
+	return func(r *Request) { held <- r }
+}
+
+func answerService(body string) SF {
+	return func(r *Request) { r.Respond(RcOK, Body(body)) }
+}
+
+func TestHedgeFastPrimary(t *testing.T) {
+	h := &HedgeService{Primary: answerService("a"), Secondary: answerService("b"), Delay: 20 * time.Millisecond}
+	if res := CallMsgBody(h, 1, Body(nil)); res.Code != RcOK || string(res.Body) != "a" {
+		t.Errorf("answered %x %q", res.Code, res.Body)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if sent, hedged, _ := h.Stats(); sent != 1 || hedged != 0 {
+		t.Errorf("sent %d, hedged %d", sent, hedged)
+	}
+}
+
+func TestHedgeSecondaryWins(t *testing.T) {
+	held := make(chan *Request, 1)
+	delay := 20 * time.Millisecond
+	h := &HedgeService{Primary: holdService(held), Secondary: answerService("b"), Delay: delay}
+	start := time.Now()
+	res := CallMsgBody(h, 1, Body(nil))
+	if res.Code != RcOK || string(res.Body) != "b" {
+		t.Errorf("answered %x %q", res.Code, res.Body)
+	}
+	if d := time.Since(start); d < delay {
+		t.Errorf("hedge fired after %v, delay is %v", d, delay)
+	}
+	if _, hedged, won := h.Stats(); hedged != 1 || won != 1 {
+		t.Errorf("hedged %d, won %d", hedged, won)
+	}
+	primary := <-held
+	if !primary.Performed() || primary.Response.Code != RcCanceled {
+		t.Errorf("losing request is not canceled")
+	}
+}
+
+func TestHedgePrimaryWins(t *testing.T) {
+	heldA := make(chan *Request, 1)
+	heldB := make(chan *Request, 1)
+	h := &HedgeService{Primary: holdService(heldA), Secondary: holdService(heldB), Delay: 10 * time.Millisecond}
+	_, res := SendMsgBody(h, 1, Body(nil))
+	primary := <-heldA
+	var secondary *Request
+	select {
+	case secondary = <-heldB:
+	case <-time.After(time.Second):
+		t.Fatal("hedge did not fire")
+	}
+	primary.Respond(RcOK, Body("a"))
+	if r := <-res; r.Code != RcOK || string(r.Body) != "a" {
+		t.Errorf("answered %x %q", r.Code, r.Body)
+	}
+	if !secondary.Performed() || secondary.Response.Code != RcCanceled {
+		t.Errorf("losing request is not canceled")
+	}
+	if _, hedged, won := h.Stats(); hedged != 1 || won != 0 {
+		t.Errorf("hedged %d, won %d", hedged, won)
+	}
+}
+
+func TestHedgeDefaultDelay(t *testing.T) {
+	h := &HedgeService{Primary: answerService("a"), Percentile: 0.5}
+	if d := h.delay(); d != DefaultHedgeDelay {
+		t.Errorf("zero Delay gives %v", d)
+	}
+}
+
+func TestHedgePercentile(t *testing.T) {
+	h := &HedgeService{Primary: answerService("a"), Secondary: answerService("b"), Delay: time.Hour, Percentile: 0.9}
+	for i := 0; i < hedgeSamples; i++ {
+		CallMsgBody(h, 1, Body(nil))
+	}
+	if d := h.delay(); d <= 0 || d >= time.Hour {
+		t.Fatalf("percentile delay is %v", d)
+	}
+	held := make(chan *Request, 1)
+	h.Primary = holdService(held)
+	if res := CallMsgBody(h, 1, Body(nil)); res.Code != RcOK || string(res.Body) != "b" {
+		t.Errorf("answered %x %q", res.Code, res.Body)
+	}
+	<-held
+}
+
+func TestHedgePrimaryFails(t *testing.T) {
+	fail := SF(func(r *Request) { r.Respond(RcIOError, nil) })
+	h := &HedgeService{Primary: fail, Secondary: answerService("b"), Delay: time.Hour}
+	done := make(chan *Response, 1)
+	go func() { done <- CallMsgBody(h, 1, Body(nil)) }()
+	select {
+	case res := <-done:
+		if res.Code != RcOK || string(res.Body) != "b" {
+			t.Errorf("answered %x %q", res.Code, res.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("duplicate is not sent when primary fails")
+	}
+	if _, hedged, _ := h.Stats(); hedged != 1 {
+		t.Errorf("hedged %d", hedged)
+	}
+}
+
+func TestHedgeParentCancel(t *testing.T) {
+	heldA := make(chan *Request, 1)
+	heldB := make(chan *Request, 1)
+	h := &HedgeService{Primary: holdService(heldA), Secondary: holdService(heldB), Delay: time.Millisecond}
+	req, res := SendMsgBody(h, 1, Body(nil))
+	primary, secondary := <-heldA, <-heldB
+	req.Cancel()
+	if r := <-res; r.Code != RcCanceled {
+		t.Errorf("canceled request answered with %x", r.Code)
+	}
+	for _, sub := range []*Request{primary, secondary} {
+		if !sub.Performed() || sub.Response.Code != RcCanceled {
+			t.Errorf("attempt is not canceled with parent")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package iprototest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+func TestRules(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.On(1).WithBody(iproto.Body("a")).Times(1).Respond(iproto.RcOK, iproto.Body("first"))
+	s.On(1).Respond(iproto.RcOK, uint32(7))
+	slow := s.On(2).Delay(50*time.Millisecond).Respond(iproto.RcOK, nil)
+	s.On(3).Close()
+
+	cl := s.Client(time.Second)
+	defer cl.Stop()
+
+	if res := iproto.CallMsgBody(cl, 1, iproto.Body("a")); res.Code != iproto.RcOK || string(res.Body) != "first" {
+		t.Errorf("unexpected response %x %q", res.Code, res.Body)
+	}
+	var v uint32
+	if res := iproto.CallMsgBody(cl, 1, iproto.Body("a")); res.Code != iproto.RcOK || res.Body.Read(&v) != nil || v != 7 {
+		t.Errorf("exhausted rule should pass to next one, got %x %v", res.Code, v)
+	}
+	st := time.Now()
+	if res := iproto.CallMsgBody(cl, 2, nil); res.Code != iproto.RcOK || time.Since(st) < 50*time.Millisecond {
+		t.Errorf("delayed response %x after %v", res.Code, time.Since(st))
+	}
+	if res := iproto.CallMsgBody(cl, 4, nil); res.Code != RcUnmatched {
+		t.Errorf("unmatched request answered with %x", res.Code)
+	}
+	if res := iproto.CallMsgBody(cl, 3, nil); res.Code != iproto.RcIOError {
+		t.Errorf("closed connection answered with %x", res.Code)
+	}
+
+	if slow.Hits() != 1 {
+		t.Errorf("slow rule hits %d", slow.Hits())
+	}
+	reqs := s.Requests()
+	if len(reqs) != 5 || reqs[0].Msg != 1 || string(reqs[0].Body) != "a" || reqs[4].Msg != 3 {
+		t.Errorf("unexpected recorded requests %+v", reqs)
+	}
+	if len(s.RequestsOf(1)) != 2 {
+		t.Errorf("expected 2 requests of type 1")
+	}
+}
+
+type user struct {
+	Id   uint32
+	Name string
+}
+
+func TestBox(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.OnBox(BoxSelect, 3).Tuples(user{1, "one"}, user{2, "two"})
+	s.OnBox(BoxStore, 3).Tuples(user{3, "three"})
+	s.On(BoxUpdate).MatchBox(func(b *BoxRequest) bool {
+		return b.Key.Uint32(0) == 5 && len(b.Ops) == 1 && b.Ops[0].Op == sbox.OpAdd
+	}).Tuples(user{5, "five"})
+	s.OnCall("ping").Tuples([]interface{}{"pong"})
+
+	cl := s.Client(time.Second)
+	defer cl.Stop()
+
+	var users []user
+	res := iproto.Call(cl, sbox.SelectReq{Space: 3, Keys: []uint32{1, 2}})
+	if _, _, err := sbox.ReadMany(res.Body, &users); err != nil || len(users) != 2 || users[1].Name != "two" {
+		t.Errorf("select got %+v %v", users, err)
+	}
+	var cnt uint32
+	res = iproto.Call(cl, sbox.StoreReq{Space: 3, Tuple: user{3, "three"}})
+	if res.Body.Read(&cnt); res.Code != iproto.RcOK || len(res.Body) != 4 || cnt != 1 {
+		t.Errorf("store without return got %x [% x]", res.Code, res.Body)
+	}
+	var u user
+	res = iproto.Call(cl, sbox.UpdateReq{Space: 3, Return: true, Key: uint32(5), Ops: []sbox.Op{{Field: 1, Op: sbox.OpAdd, Val: uint32(1)}}})
+	if _, _, err := sbox.ReadFirst(res.Body, &u); err != nil || u.Id != 5 {
+		t.Errorf("update got %+v %v", u, err)
+	}
+	res = iproto.Call(cl, sbox.RPCReq{Name: "ping", Args: []string{"x"}})
+	var pong []string
+	if _, _, err := sbox.ReadFirst(res.Body, &pong); err != nil || len(pong) != 1 || pong[0] != "pong" {
+		t.Errorf("call got %q %v", pong, err)
+	}
+
+	reqs := s.RequestsOf(BoxSelect)
+	if len(reqs) != 1 {
+		t.Fatalf("expected one select, got %d", len(reqs))
+	}
+	b, err := ParseBox(reqs[0].Msg, reqs[0].Body)
+	if err != nil || b.Space != 3 || len(b.Keys) != 2 || b.Keys[1].Uint32(0) != 2 {
+		t.Errorf("parsed select %+v %v", b, err)
+	}
+	call := s.RequestsOf(BoxCall)
+	if b, err = ParseBox(BoxCall, call[0].Body); err != nil || b.Proc != "ping" || len(b.Args) != 1 || b.Args[0] != "x" {
+		t.Errorf("parsed call %+v %v", b, err)
+	}
+}
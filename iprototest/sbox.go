@@ -0,0 +1,213 @@
+package iprototest
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+	"github.com/funny-falcon/go-iproto/sbox"
+)
+
+const (
+	BoxStore  = iproto.RequestType(13)
+	BoxSelect = iproto.RequestType(17)
+	BoxUpdate = iproto.RequestType(19)
+	BoxDelete = iproto.RequestType(21)
+	BoxCall   = iproto.RequestType(22)
+)
+
+// Tuple is a raw box tuple
+type Tuple [][]byte
+
+// Uint32 returns field i as uint32, or 0 if there is no such 4-byte field
+func (t Tuple) Uint32(i int) uint32 {
+	if i < len(t) && len(t[i]) == 4 {
+		return binary.LittleEndian.Uint32(t[i])
+	}
+	return 0
+}
+
+// Uint64 returns field i as uint64, or 0 if there is no such 8-byte field
+func (t Tuple) Uint64(i int) uint64 {
+	if i < len(t) && len(t[i]) == 8 {
+		return binary.LittleEndian.Uint64(t[i])
+	}
+	return 0
+}
+
+// String returns field i as string, or "" if there is no such field
+func (t Tuple) String(i int) string {
+	if i < len(t) {
+		return string(t[i])
+	}
+	return ""
+}
+
+// BoxOp is an update operation
+type BoxOp struct {
+	Field uint32
+	Op    sbox.OpKind
+	Val   []byte
+}
+
+var opKinds = [...]sbox.OpKind{
+	sbox.OpSet, sbox.OpAdd, sbox.OpAnd, sbox.OpOr,
+	sbox.OpXor, sbox.OpSplice, sbox.OpDelete, sbox.OpInsert,
+}
+
+// BoxRequest is parsed sbox request
+type BoxRequest struct {
+	Msg   iproto.RequestType
+	Space uint32
+	Flags uint32
+
+	/* select */
+	Index, Offset uint32
+	Limit         int32
+	Keys          []Tuple
+
+	/* update and delete */
+	Key Tuple
+	Ops []BoxOp
+
+	/* store */
+	Tuple Tuple
+
+	/* call */
+	Proc string
+	Args []string
+}
+
+// Return reports whether store, update or delete asks to return tuple
+func (b *BoxRequest) Return() bool {
+	return b.Flags&1 != 0
+}
+
+// ParseBox parses body of sbox request of type msg
+func ParseBox(msg iproto.RequestType, body []byte) (b *BoxRequest, err error) {
+	r := &marshal.Reader{Body: body}
+	b = &BoxRequest{Msg: msg}
+	switch msg {
+	case BoxSelect:
+		b.Space = r.Uint32()
+		b.Index = r.Uint32()
+		b.Offset = r.Uint32()
+		b.Limit = r.Int32()
+		n := readCount(r)
+		for i := 0; i < n && r.Err == nil; i++ {
+			b.Keys = append(b.Keys, readTuple(r))
+		}
+	case BoxStore:
+		b.Space = r.Uint32()
+		b.Flags = r.Uint32()
+		b.Tuple = readTuple(r)
+	case BoxUpdate:
+		b.Space = r.Uint32()
+		b.Flags = r.Uint32()
+		b.Key = readTuple(r)
+		n := readCount(r)
+		for i := 0; i < n && r.Err == nil; i++ {
+			op := BoxOp{Field: r.Uint32()}
+			if k := r.Uint8(); int(k) < len(opKinds) {
+				op.Op = opKinds[k]
+			} else {
+				op.Op = sbox.OpKind(k)
+			}
+			op.Val = readField(r)
+			b.Ops = append(b.Ops, op)
+		}
+	case BoxDelete:
+		b.Space = r.Uint32()
+		b.Flags = r.Uint32()
+		b.Key = readTuple(r)
+	case BoxCall:
+		b.Flags = r.Uint32()
+		b.Proc = string(readField(r))
+		n := readCount(r)
+		for i := 0; i < n && r.Err == nil; i++ {
+			b.Args = append(b.Args, string(readField(r)))
+		}
+	default:
+		return nil, fmt.Errorf("iprototest: %d is not a box request", msg)
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return b, nil
+}
+
+func readCount(r *marshal.Reader) int {
+	n := r.IntUint32()
+	/* every element takes at least one byte */
+	if r.Err == nil && (n < 0 || n > len(r.Body)) {
+		r.Err = fmt.Errorf("iprototest: count %d is larger than body", n)
+	}
+	return n
+}
+
+func readField(r *marshal.Reader) []byte {
+	sz := r.Intvar()
+	if r.Err == nil && sz < 0 {
+		r.Err = fmt.Errorf("iprototest: wrong field size %d", sz)
+	}
+	return r.Slice(sz)
+}
+
+func readTuple(r *marshal.Reader) (t Tuple) {
+	n := readCount(r)
+	for i := 0; i < n && r.Err == nil; i++ {
+		t = append(t, readField(r))
+	}
+	return
+}
+
+// TuplesBody builds body of box answer: count of tuples followed by tuples
+func TuplesBody(tuples ...interface{}) []byte {
+	var w, tw marshal.Writer
+	w.IntUint32(len(tuples))
+	for _, t := range tuples {
+		tw.Reset()
+		sbox.WriteTuple(&tw, t)
+		b := tw.Written()
+		/* size excludes field count */
+		w.IntUint32(len(b) - 4)
+		w.Bytes(b)
+	}
+	return w.Written()
+}
+
+// OnBox adds rule for box requests of type msg to space. Use OnCall for procedure calls.
+func (s *Server) OnBox(msg iproto.RequestType, space uint32) *Rule {
+	return s.On(msg).MatchBox(func(b *BoxRequest) bool { return b.Space == space })
+}
+
+// OnCall adds rule for call of procedure proc
+func (s *Server) OnCall(proc string) *Rule {
+	return s.On(BoxCall).MatchBox(func(b *BoxRequest) bool { return b.Proc == proc })
+}
+
+// MatchBox restricts rule to well formed box requests satisfying f
+func (rl *Rule) MatchBox(f func(b *BoxRequest) bool) *Rule {
+	msg := rl.msg
+	return rl.Match(func(body []byte) bool {
+		b, err := ParseBox(msg, body)
+		return err == nil && f(b)
+	})
+}
+
+// Tuples answers with RcOK and tuples. Store, update and delete without return flag
+// are answered with count only, as box does.
+func (rl *Rule) Tuples(tuples ...interface{}) *Rule {
+	body := TuplesBody(tuples...)
+	return rl.Handle(func(r *iproto.Request) {
+		switch r.Msg {
+		case BoxStore, BoxUpdate, BoxDelete:
+			if len(r.Body) >= 8 && binary.LittleEndian.Uint32(r.Body[4:])&1 == 0 {
+				r.RespondBytes(iproto.RcOK, body[:4])
+				return
+			}
+		}
+		r.RespondBytes(iproto.RcOK, body)
+	})
+}
@@ -0,0 +1,272 @@
+// Package iprototest provides scripted iproto server for unit tests.
+//
+// Server listens on ephemeral local port and answers requests according to rules:
+//
+//	s := iprototest.NewServer()
+//	defer s.Close()
+//	s.On(1).Respond(iproto.RcOK, iproto.Body("pong"))
+//	s.On(2).Delay(time.Second).Respond(iproto.RcOK, nil)
+//	s.OnBox(sbox.SelectReq{}.IMsg(), 3).Tuples(MyTuple{Id: 1})
+//
+//	cl := s.Client(time.Second)
+//	defer cl.Stop()
+//	...
+//	reqs := s.Requests()
+package iprototest
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+// RcUnmatched is default answer for requests which match no rule.
+// It is the code octopus answers on unsupported command.
+const RcUnmatched = iproto.RetCode(0x0a02)
+
+// Request is a request recorded by Server
+type Request struct {
+	Msg    iproto.RequestType
+	Body   []byte
+	Remote string
+	Time   time.Time
+}
+
+// Server is iproto server answering with scripted rules
+type Server struct {
+	*server.Server
+	// Unmatched is code for requests which match no rule, RcUnmatched by default
+	Unmatched iproto.RetCode
+
+	m     sync.Mutex
+	rules []*Rule
+	reqs  []Request
+}
+
+// NewServer starts server on 127.0.0.1 ephemeral port
+func NewServer() *Server {
+	return NewServerConfig(server.Config{})
+}
+
+// NewServerConfig starts server with cfg. Network and EndPoint are overridden,
+// Address is 127.0.0.1:0 unless set.
+func NewServerConfig(cfg server.Config) *Server {
+	s := &Server{Unmatched: RcUnmatched}
+	cfg.Network = "tcp"
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:0"
+	}
+	cfg.EndPoint = iproto.SF(s.serve)
+	s.Server = cfg.NewServer()
+	if err := s.Server.Run(); err != nil {
+		log.Panicf("iprototest: could not start server: %v", err)
+	}
+	return s
+}
+
+// Address returns host:port server listens on
+func (s *Server) Address() string {
+	return s.Addr().String()
+}
+
+// Client returns running client connected to server. It should be stopped by caller.
+func (s *Server) Client(timeout time.Duration) *client.Server {
+	cl := client.ServerConfig{Address: s.Address(), Timeout: timeout}.NewServer()
+	iproto.Run(cl)
+	return cl
+}
+
+// Close stops server, requests which are not answered yet (delayed or hung) are canceled
+func (s *Server) Close() {
+	s.Shutdown(0)
+}
+
+// On adds rule for requests of type msg. Rules are checked in order they were added,
+// first matching and not exhausted rule answers request.
+func (s *Server) On(msg iproto.RequestType) *Rule {
+	r := &Rule{s: s, msg: msg, times: -1}
+	s.m.Lock()
+	s.rules = append(s.rules, r)
+	s.m.Unlock()
+	return r
+}
+
+// Requests returns all requests received by server
+func (s *Server) Requests() []Request {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]Request(nil), s.reqs...)
+}
+
+// RequestsOf returns received requests of type msg
+func (s *Server) RequestsOf(msg iproto.RequestType) (reqs []Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, r := range s.reqs {
+		if r.Msg == msg {
+			reqs = append(reqs, r)
+		}
+	}
+	return
+}
+
+// Reset forgets all rules and recorded requests
+func (s *Server) Reset() {
+	s.m.Lock()
+	s.rules = nil
+	s.reqs = nil
+	s.m.Unlock()
+}
+
+func (s *Server) serve(r *iproto.Request) {
+	conn := server.ConnOf(r)
+	req := Request{Msg: r.Msg, Body: append([]byte(nil), r.Body...), Time: time.Now()}
+	if conn != nil {
+		req.Remote = conn.RemoteAddr().String()
+	}
+
+	s.m.Lock()
+	s.reqs = append(s.reqs, req)
+	var rule *Rule
+	for _, rl := range s.rules {
+		if rl.times != 0 && rl.matches(r.Msg, req.Body) {
+			rule = rl
+			break
+		}
+	}
+	if rule != nil {
+		rule.hits++
+		if rule.times > 0 {
+			rule.times--
+		}
+	}
+	unmatched := s.Unmatched
+	s.m.Unlock()
+
+	if rule == nil {
+		r.RespondBytes(unmatched, nil)
+		return
+	}
+	rule.serve(r, conn)
+}
+
+// Rule describes answer on matching requests. Rule should be configured before
+// requests matching it are sent.
+type Rule struct {
+	s       *Server
+	msg     iproto.RequestType
+	match   []func(body []byte) bool
+	code    iproto.RetCode
+	body    []byte
+	handler func(*iproto.Request)
+	delay   time.Duration
+	close   bool
+	hang    bool
+	times   int
+	hits    int
+}
+
+func (rl *Rule) matches(msg iproto.RequestType, body []byte) bool {
+	if rl.msg != msg {
+		return false
+	}
+	for _, m := range rl.match {
+		if !m(body) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithBody restricts rule to requests with exactly this body. body is marshaled unless it is iproto.Body.
+func (rl *Rule) WithBody(body interface{}) *Rule {
+	b := toBytes(body)
+	return rl.Match(func(body []byte) bool { return bytes.Equal(b, body) })
+}
+
+// Match restricts rule to requests which body satisfies f
+func (rl *Rule) Match(f func(body []byte) bool) *Rule {
+	rl.match = append(rl.match, f)
+	return rl
+}
+
+// Respond answers with code and body. body is marshaled unless it is iproto.Body.
+func (rl *Rule) Respond(code iproto.RetCode, body interface{}) *Rule {
+	rl.code = code
+	rl.body = toBytes(body)
+	return rl
+}
+
+// Handle gives full control over answer
+func (rl *Rule) Handle(f func(r *iproto.Request)) *Rule {
+	rl.handler = f
+	return rl
+}
+
+// Delay postpones answer (or closing connection)
+func (rl *Rule) Delay(d time.Duration) *Rule {
+	rl.delay = d
+	return rl
+}
+
+// Close closes connection instead of answering
+func (rl *Rule) Close() *Rule {
+	rl.close = true
+	return rl
+}
+
+// Hang never answers request, it will be canceled when connection or server is closed
+func (rl *Rule) Hang() *Rule {
+	rl.hang = true
+	return rl
+}
+
+// Times limits number of requests answered by rule, next requests are passed to following rules
+func (rl *Rule) Times(n int) *Rule {
+	rl.times = n
+	return rl
+}
+
+// Hits returns number of requests matched by rule
+func (rl *Rule) Hits() int {
+	rl.s.m.Lock()
+	defer rl.s.m.Unlock()
+	return rl.hits
+}
+
+func (rl *Rule) serve(r *iproto.Request, conn *server.Connection) {
+	act := func() {
+		switch {
+		case rl.close:
+			if conn != nil {
+				conn.Close()
+			}
+		case rl.hang:
+		case rl.handler != nil:
+			rl.handler(r)
+		default:
+			r.RespondBytes(rl.code, rl.body)
+		}
+	}
+	if rl.delay > 0 {
+		time.AfterFunc(rl.delay, act)
+	} else {
+		act()
+	}
+}
+
+func toBytes(body interface{}) []byte {
+	if b, ok := body.(iproto.Body); ok {
+		return b
+	}
+	if body == nil {
+		return nil
+	}
+	return marshal.Write(body)
+}
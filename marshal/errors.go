@@ -0,0 +1,88 @@
+package marshal
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Errors returned by Reader and Writer. Type errors (UnsupportedTypeError, BadTagError) are found
+once per type and then returned on each encode or decode of it; data errors (ShortBodyError,
+TrailingBytesError) mean that body is malformed. Use errors.As to tell them apart.
+*/
+
+// UnsupportedTypeError is returned for type which could not be encoded or decoded
+type UnsupportedTypeError struct {
+	Type   reflect.Type
+	Reason string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("Don't know how to handle type %v", e.Type)
+	}
+	return fmt.Sprintf("Don't know how to handle type %v: %s", e.Type, e.Reason)
+}
+
+// BadTagError is returned for struct field with wrong or conflicting tag directives
+type BadTagError struct {
+	Struct reflect.Type
+	Field  string
+	Tag    reflect.StructTag
+	Reason string
+}
+
+func (e *BadTagError) Error() string {
+	return fmt.Sprintf("Wrong tag `%s` of field %s in %v: %s", e.Tag, e.Field, e.Struct, e.Reason)
+}
+
+// ShortBodyError is returned when body ends before value is read,
+// or when size or count read could not fit in the rest of body
+type ShortBodyError struct {
+	What string
+}
+
+func (e *ShortBodyError) Error() string {
+	return "iproto.Reader: not enough data for " + e.What
+}
+
+// TrailingBytesError is returned when value does not consume whole body given to it,
+// either by its size prefix or by ReadTail
+type TrailingBytesError struct {
+	Left int
+}
+
+func (e *TrailingBytesError) Error() string {
+	return fmt.Sprintf("iproto.Reader: %d bytes left unread", e.Left)
+}
+
+/* wrongSlice is set by <T>slVal readers given a slice of other element type */
+func (r *Reader) wrongSlice(v reflect.Value, fn string) {
+	if r.Err == nil {
+		r.Err = &UnsupportedTypeError{Type: v.Type(), Reason: fn + " called on wrong slice"}
+	}
+}
+
+func (t *TReader) fail(err error) {
+	t.Err = err
+	t.Sz, t.Cnt = -1, -1
+	t.AutoCount, t.AutoSize, t.SzSet, t.CntSet = nil, nil, nil, nil
+	t.Flds = nil
+	f := func(r *Reader, v reflect.Value) {
+		if r.Err == nil {
+			r.Err = err
+		}
+	}
+	t.Fixed, t.Tail, t.Auto = f, f, f
+}
+
+func (t *TWriter) fail(err error) {
+	t.Err = err
+	t.Sz, t.Cnt = -1, -1
+	t.SzGet, t.CntGet = nil, nil
+	t.Flds = nil
+	f := func(w *Writer, v reflect.Value) {
+		w.setErr(err)
+	}
+	t.Write, t.WriteAuto = f, f
+}
@@ -0,0 +1,74 @@
+package marshal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type SBadTag struct {
+	A []uint32 `iproto:"size(i32),cnt(i32)"`
+}
+
+type SBadField struct {
+	A uint32
+	M map[string]int
+}
+
+func TestErrors(t *testing.T) {
+	var bt *BadTagError
+	if err := Read([]byte{0, 0, 0, 0}, new(SBadTag)); !errors.As(err, &bt) || bt.Field != "A" {
+		t.Errorf("bad tag: %v", err)
+	}
+	if _, err := TryWrite(SBadTag{}); !errors.As(err, &bt) {
+		t.Errorf("bad tag on write: %v", err)
+	}
+
+	var ut *UnsupportedTypeError
+	if err := Read([]byte{0, 0, 0, 0}, new(SBadField)); !errors.As(err, &ut) {
+		t.Errorf("unsupported type: %v", err)
+	}
+	if _, err := TryWrite(SBadField{}); !errors.As(err, &ut) {
+		t.Errorf("unsupported type on write: %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Write should panic on unsupported type")
+			}
+		}()
+		Write(SBadField{})
+	}()
+	if _, err := TryWriteTail(SBadField{}); !errors.As(err, &ut) {
+		t.Errorf("unsupported type on write tail: %v", err)
+	}
+	/* typed slice readers and writers do not panic on foreign slice */
+	var r Reader
+	if r.Uint32slVal(reflect.ValueOf([]int8{1})); !errors.As(r.Err, &ut) {
+		t.Errorf("wrong slice read: %v", r.Err)
+	}
+	var w Writer
+	if w.Float64slVal(reflect.ValueOf([]uint8{1})); !errors.As(w.Err, &ut) {
+		t.Errorf("wrong slice write: %v", w.Err)
+	}
+
+	var sb *ShortBodyError
+	if err := Read([]byte{1, 0}, new(uint32)); !errors.As(err, &sb) {
+		t.Errorf("short body: %v", err)
+	}
+	/* count is checked before slice is allocated */
+	if err := Read([]byte{0xff, 0xff, 0xff, 0x7f, 1, 2}, new([]uint32)); !errors.As(err, &sb) {
+		t.Errorf("huge count: %v", err)
+	}
+	if err := Read([]byte{0xff, 0xff, 0xff, 0x7f, 1, 2}, new(SSlice1)); !errors.As(err, &sb) {
+		t.Errorf("huge count in struct: %v", err)
+	}
+
+	var tb *TrailingBytesError
+	if err := ReadTail([]byte{1, 0, 0, 0, 2}, new(uint32)); !errors.As(err, &tb) || tb.Left != 1 {
+		t.Errorf("trailing bytes: %v", err)
+	}
+	if err := Read([]byte{5, 1, 2, 3, 4, 5}, new(SInts11)); !errors.As(err, &tb) {
+		t.Errorf("trailing bytes of sized field: %v", err)
+	}
+}
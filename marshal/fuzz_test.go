@@ -0,0 +1,24 @@
+//go:build go1.18
+
+package marshal
+
+import (
+	"testing"
+)
+
+/* decoding of malformed body should return error, but never panic */
+func FuzzRead(f *testing.F) {
+	for _, should := range shoulds {
+		f.Add(should.m)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, should := range shoulds {
+			Read(b, zerovalue_pointer(should.v))
+			ReadTail(b, zerovalue_pointer(should.v))
+		}
+		/* types decoded without reflection */
+		for _, v := range []interface{}{new(string), new([]byte), new([]int16), new([]uint32), new([]float64), new([]interface{})} {
+			Read(b, v)
+		}
+	})
+}
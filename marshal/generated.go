@@ -0,0 +1,73 @@
+package marshal
+
+import (
+	"fmt"
+)
+
+/* Helpers for IWrite/IRead methods generated by cmd/iprotogen */
+
+// Uint64varSize returns number of bytes written by Uint64var(i)
+func Uint64varSize(i uint64) int {
+	return varu64size(i)
+}
+
+// WriteSized writes output of f prefixed with its size, for fields which size is not known in advance
+func (w *Writer) WriteSized(szwr func(*Writer, int), f func(*Writer)) {
+	var tw *Writer
+	select {
+	case tw = <-twriters:
+	default:
+		tw = &Writer{DefSize: 128}
+	}
+	f(tw)
+	body := tw.Written()
+	szwr(w, len(body))
+	w.Bytes(body)
+	if tw.Err != nil {
+		w.setErr(tw.Err)
+	}
+	puttwriter(tw)
+}
+
+// ReadSized reads size with szrd and passes that much of body to f, which should consume it whole
+func (r *Reader) ReadSized(szrd func(*Reader) int, f func(*Reader)) {
+	sz := szrd(r)
+	if r.Err != nil {
+		return
+	}
+	rr := Reader{Body: r.Slice(sz), Err: r.Err}
+	if rr.Err != nil {
+		return
+	}
+	f(&rr)
+	if rr.Err != nil {
+		r.Err = rr.Err
+	} else if len(rr.Body) != 0 {
+		r.Err = &TrailingBytesError{Left: len(rr.Body)}
+	}
+}
+
+// ExpectSize sets error if size or count read is not equal to need
+func (r *Reader) ExpectSize(got, need int) bool {
+	if r.Err != nil {
+		return false
+	}
+	if got != need {
+		r.Err = fmt.Errorf("Size doesn't match %d %d", got, need)
+		return false
+	}
+	return true
+}
+
+// CheckCount sets error if n elements of at least elemSize bytes could not fit in the rest of body,
+// so malformed count does not lead to huge allocation. Zero elemSize checks only that n is not negative.
+func (r *Reader) CheckCount(n, elemSize int) bool {
+	if r.Err != nil {
+		return false
+	}
+	if n < 0 || elemSize > 0 && n > len(r.Body)/elemSize {
+		r.Err = &ShortBodyError{What: fmt.Sprintf("count %d", n)}
+		return false
+	}
+	return true
+}
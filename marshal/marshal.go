@@ -2,6 +2,7 @@ package marshal
 
 import (
 	"encoding/binary"
+	"log"
 	"reflect"
 	"sync"
 	"unsafe"
@@ -97,20 +98,48 @@ var writerPool = sync.Pool{
 	},
 }
 
+// Write encodes i, it panics if i could not be encoded; use TryWrite to get an error instead.
+// Writer fails only on type errors (UnsupportedTypeError, BadTagError), never on values,
+// so the panic is a programmer's error and could not be caused by input.
 func Write(i interface{}) (res []byte) {
+	res, err := TryWrite(i)
+	if err != nil {
+		log.Panic(err)
+	}
+	return res
+}
+
+// TryWrite encodes i as Write does, but returns an error instead of panic
+func TryWrite(i interface{}) (res []byte, err error) {
 	w := writerPool.Get().(*Writer)
 	w.Write(i)
-	res = w.Written()
+	if res, err = w.Written(), w.Err; err != nil {
+		res = nil
+	}
+	w.Reset()
 	writerPool.Put(w)
-	return res
+	return
 }
 
+// WriteTail encodes i without size prefix, it panics as Write does; use TryWriteTail to get an error instead
 func WriteTail(i interface{}) (res []byte) {
+	res, err := TryWriteTail(i)
+	if err != nil {
+		log.Panic(err)
+	}
+	return res
+}
+
+// TryWriteTail encodes i as WriteTail does, but returns an error instead of panic
+func TryWriteTail(i interface{}) (res []byte, err error) {
 	w := writerPool.Get().(*Writer)
 	w.WriteTail(i)
-	res = w.Written()
+	if res, err = w.Written(), w.Err; err != nil {
+		res = nil
+	}
+	w.Reset()
 	writerPool.Put(w)
-	return res
+	return
 }
 
 type efaceHeader struct {
@@ -153,7 +182,7 @@ var tfloat64 = reflect.TypeOf(float64(0))
 const gg = 2*1024*1024*1024 - 1
 
 func Varsize(i int) (j int) {
-	for j = 0; i > 1<<7; j++ {
+	for j = 0; i >= 1<<7; j++ {
 		i >>= 7
 	}
 	return j + 1
@@ -307,3 +307,47 @@ func BenchmarkDecode(b *testing.B) {
 		}
 	}
 }
+
+func TestVarsize(t *testing.T) {
+	var w Writer
+	for _, i := range []uint64{0, 1<<7 - 1, 1 << 7, 1<<14 - 1, 1 << 14, 1 << 21, 1 << 28, 1 << 35} {
+		w.Reset()
+		w.Uint64var(i)
+		n := len(w.Written())
+		if Varsize(int(i)) != n || varu64size(i) != n {
+			t.Errorf("size of %d: Varsize %d, varu64size %d, written %d", i, Varsize(int(i)), varu64size(i), n)
+		}
+	}
+}
+
+func TestFloat64sl(t *testing.T) {
+	var w Writer
+	f := []float64{1.5, -2.25, 1e100}
+	w.Float64sl(f)
+	var g []float64
+	if err := ReadTail(w.Written(), &g); err != nil || !reflect.DeepEqual(f, g) {
+		t.Errorf("float64 slice %v read as %v %v", f, g, err)
+	}
+}
+
+type SU32sl []uint32
+
+/* named slice goes through reflection based Tail reader */
+func TestSliceTail(t *testing.T) {
+	var s SU32sl
+	if err := ReadTail([]byte{1, 0, 0, 0, 2, 0, 0, 0}, &s); err != nil || !reflect.DeepEqual(s, SU32sl{1, 2}) {
+		t.Errorf("tail read as %v %v", s, err)
+	}
+}
+
+type SNoSize struct {
+	A uint8
+	T []uint32 `iproto:"size(no)"`
+}
+
+func TestNoSizeField(t *testing.T) {
+	var s SNoSize
+	if err := Read([]byte{1, 2, 0, 0, 0, 3, 0, 0, 0}, &s); err != nil || s.A != 1 || !reflect.DeepEqual(s.T, []uint32{2, 3}) {
+		t.Errorf("size(no) field read as %+v %v", s, err)
+	}
+}
@@ -1,7 +1,6 @@
 package marshal
 
 import (
-	"errors"
 	"fmt"
 	"log"
 	"reflect"
@@ -20,7 +19,7 @@ func (r *Reader) Uint8() (res uint8) {
 		return
 	}
 	if len(r.Body) < 1 {
-		r.Err = errors.New("iproto.Reader: not enough data for uint8")
+		r.Err = &ShortBodyError{What: "uint8"}
 		return
 	}
 	res = r.Body[0]
@@ -33,7 +32,7 @@ func (r *Reader) Int8() (res int8) {
 		return
 	}
 	if len(r.Body) < 1 {
-		r.Err = errors.New("iproto.Reader: not enough data for int8")
+		r.Err = &ShortBodyError{What: "int8"}
 		return
 	}
 	res = int8(r.Body[0])
@@ -59,7 +58,7 @@ func (r *Reader) Uint64var() (res uint64) {
 			return
 		}
 	}
-	r.Err = fmt.Errorf("iproto.Reader: not enough data for uint64var %x", r)
+	r.Err = &ShortBodyError{What: "uint64var"}
 	return
 }
 
@@ -93,7 +92,7 @@ func (r *Reader) Uint8sl(b []uint8) {
 		return
 	}
 	if len(r.Body) < len(b) {
-		r.Err = errors.New("iproto.Reader: not enough data for []uint8")
+		r.Err = &ShortBodyError{What: "[]uint8"}
 		return
 	}
 	copy(b, r.Body)
@@ -106,7 +105,7 @@ func (r *Reader) Bytes(b []byte) {
 		return
 	}
 	if len(r.Body) < len(b) {
-		r.Err = errors.New("iproto.Reader: not enough data for []byte")
+		r.Err = &ShortBodyError{What: "[]byte"}
 		return
 	}
 	copy(b, r.Body)
@@ -119,7 +118,7 @@ func (r *Reader) Int8sl(b []int8) {
 		return
 	}
 	if len(r.Body) < len(b) {
-		r.Err = errors.New("iproto.Reader: not enough data for []uint8")
+		r.Err = &ShortBodyError{What: "[]uint8"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -133,8 +132,8 @@ func (r *Reader) Slice(sz int) (res []byte) {
 	if r.Err != nil {
 		return
 	}
-	if len(r.Body) < sz {
-		r.Err = fmt.Errorf("iproto.Reader: not enough data for Slice(%d)", sz)
+	if sz < 0 || len(r.Body) < sz {
+		r.Err = &ShortBodyError{What: fmt.Sprintf("Slice(%d)", sz)}
 		return
 	}
 	res = r.Body[:sz]
@@ -146,8 +145,8 @@ func (r *Reader) String(sz int) (res string) {
 	if r.Err != nil {
 		return
 	}
-	if len(r.Body) < sz {
-		r.Err = fmt.Errorf("iproto.Reader: not enough data for Slice(%d)", sz)
+	if sz < 0 || len(r.Body) < sz {
+		r.Err = &ShortBodyError{What: fmt.Sprintf("Slice(%d)", sz)}
 		return
 	}
 	res = string(r.Body[:sz])
@@ -213,7 +212,8 @@ func (r *Reader) Uint8slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint8 {
-			panic("Uint8slVal called on wrong slice")
+			r.wrongSlice(v, "Uint8slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]byte)(unsafe.Pointer(&sh))
@@ -226,7 +226,8 @@ func (r *Reader) Int8slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int8 {
-			panic("Int8slVal called on wrong slice")
+			r.wrongSlice(v, "Int8slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]byte)(unsafe.Pointer(&sh))
@@ -240,7 +241,7 @@ func (r *Reader) Uint8slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		//l := len(r.Body)
-		//v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		//v.Set(reflect.MakeSlice(v.Type(), l, l))
 		p := v.Addr().Interface().(*[]byte)
 		*p = r.Tail()
 	} else {
@@ -254,7 +255,7 @@ func (r *Reader) Uint16slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 2
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Uint16slVal(v)
 }
@@ -265,7 +266,7 @@ func (r *Reader) Uint32slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 4
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Uint32slVal(v)
 }
@@ -276,7 +277,7 @@ func (r *Reader) Uint64slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 8
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Uint64slVal(v)
 }
@@ -287,7 +288,7 @@ func (r *Reader) Int8slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body)
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Int8slVal(v)
 }
@@ -298,7 +299,7 @@ func (r *Reader) Int16slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 2
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Int16slVal(v)
 }
@@ -309,7 +310,7 @@ func (r *Reader) Int32slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 4
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Int32slVal(v)
 }
@@ -320,7 +321,7 @@ func (r *Reader) Int64slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 8
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Int64slVal(v)
 }
@@ -331,7 +332,7 @@ func (r *Reader) Float32slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 4
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Float32slVal(v)
 }
@@ -342,7 +343,7 @@ func (r *Reader) Float64slValTail(v reflect.Value) {
 	}
 	if v.CanAddr() {
 		l := len(r.Body) / 8
-		v.Set(reflect.MakeSlice(v.Type().Elem(), l, l))
+		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	}
 	r.Float64slVal(v)
 }
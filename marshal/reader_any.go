@@ -1,7 +1,6 @@
 package marshal
 
 import (
-	"errors"
 	"math"
 	"reflect"
 	"unsafe"
@@ -12,7 +11,7 @@ func (r *Reader) Uint16() (res uint16) {
 		return
 	}
 	if len(r.Body) < 2 {
-		r.Err = errors.New("iproto.Reader: not enough data for uint16")
+		r.Err = &ShortBodyError{What: "uint16"}
 		return
 	}
 	res = le.Uint16(r.Body)
@@ -25,7 +24,7 @@ func (r *Reader) Int16() (res int16) {
 		return
 	}
 	if len(r.Body) < 2 {
-		r.Err = errors.New("iproto.Reader: not enough data for int16")
+		r.Err = &ShortBodyError{What: "int16"}
 		return
 	}
 	res = int16(le.Uint16(r.Body))
@@ -38,7 +37,7 @@ func (r *Reader) Uint32() (res uint32) {
 		return
 	}
 	if len(r.Body) < 4 {
-		r.Err = errors.New("iproto.Reader: not enough data for uint32")
+		r.Err = &ShortBodyError{What: "uint32"}
 		return
 	}
 	res = le.Uint32(r.Body)
@@ -51,7 +50,7 @@ func (r *Reader) Int32() (res int32) {
 		return
 	}
 	if len(r.Body) < 4 {
-		r.Err = errors.New("iproto.Reader: not enough data for int32")
+		r.Err = &ShortBodyError{What: "int32"}
 		return
 	}
 	res = int32(le.Uint32(r.Body))
@@ -64,7 +63,7 @@ func (r *Reader) Uint64() (res uint64) {
 		return
 	}
 	if len(r.Body) < 8 {
-		r.Err = errors.New("iproto.Reader: not enough data for uint64")
+		r.Err = &ShortBodyError{What: "uint64"}
 		return
 	}
 	res = le.Uint64(r.Body)
@@ -77,7 +76,7 @@ func (r *Reader) Int64() (res int64) {
 		return
 	}
 	if len(r.Body) < 8 {
-		r.Err = errors.New("iproto.Reader: not enough data for int64")
+		r.Err = &ShortBodyError{What: "int64"}
 		return
 	}
 	res = int64(le.Uint64(r.Body))
@@ -90,7 +89,7 @@ func (r *Reader) Float32() (res float32) {
 		return
 	}
 	if len(r.Body) < 4 {
-		r.Err = errors.New("iproto.Reader: not enough data for float32")
+		r.Err = &ShortBodyError{What: "float32"}
 		return
 	}
 	res = math.Float32frombits(le.Uint32(r.Body))
@@ -103,7 +102,7 @@ func (r *Reader) Float64() (res float64) {
 		return
 	}
 	if len(r.Body) < 8 {
-		r.Err = errors.New("iproto.Reader: not enough data for float64")
+		r.Err = &ShortBodyError{What: "float64"}
 		return
 	}
 	res = math.Float64frombits(le.Uint64(r.Body))
@@ -116,7 +115,7 @@ func (r *Reader) Uint16sl(b []uint16) {
 		return
 	}
 	if len(r.Body) < len(b)*2 {
-		r.Err = errors.New("iproto.Reader: not enough data for []uint16")
+		r.Err = &ShortBodyError{What: "[]uint16"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -131,7 +130,7 @@ func (r *Reader) Int16sl(b []int16) {
 		return
 	}
 	if len(r.Body) < len(b)*2 {
-		r.Err = errors.New("iproto.Reader: not enough data for []int16")
+		r.Err = &ShortBodyError{What: "[]int16"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -146,7 +145,7 @@ func (r *Reader) Uint32sl(b []uint32) {
 		return
 	}
 	if len(r.Body) < len(b)*4 {
-		r.Err = errors.New("iproto.Reader: not enough data for []uint32")
+		r.Err = &ShortBodyError{What: "[]uint32"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -161,7 +160,7 @@ func (r *Reader) Int32sl(b []int32) {
 		return
 	}
 	if len(r.Body) < len(b)*4 {
-		r.Err = errors.New("iproto.Reader: not enough data for []int32")
+		r.Err = &ShortBodyError{What: "[]int32"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -176,7 +175,7 @@ func (r *Reader) Uint64sl(b []uint64) {
 		return
 	}
 	if len(r.Body) < len(b)*8 {
-		r.Err = errors.New("iproto.Reader: not enough data for []uint64")
+		r.Err = &ShortBodyError{What: "[]uint64"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -191,7 +190,7 @@ func (r *Reader) Int64sl(b []int64) {
 		return
 	}
 	if len(r.Body) < len(b)*8 {
-		r.Err = errors.New("iproto.Reader: not enough data for []int64")
+		r.Err = &ShortBodyError{What: "[]int64"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -206,7 +205,7 @@ func (r *Reader) Float32sl(b []float32) {
 		return
 	}
 	if len(r.Body) < len(b)*4 {
-		r.Err = errors.New("iproto.Reader: not enough data for []float32")
+		r.Err = &ShortBodyError{What: "[]float32"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -221,7 +220,7 @@ func (r *Reader) Float64sl(b []float64) {
 		return
 	}
 	if len(r.Body) < len(b)*8 {
-		r.Err = errors.New("iproto.Reader: not enough data for []float64")
+		r.Err = &ShortBodyError{What: "[]float64"}
 		return
 	}
 	for i := 0; i < len(b); i++ {
@@ -236,7 +235,8 @@ func (r *Reader) Uint16slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint16 {
-			panic("Uint16slVal called on wrong slice")
+			r.wrongSlice(v, "Uint16slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]uint16)(unsafe.Pointer(&sh))
@@ -249,7 +249,8 @@ func (r *Reader) Uint32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint32 {
-			panic("Uint32slVal called on wrong slice")
+			r.wrongSlice(v, "Uint32slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]uint32)(unsafe.Pointer(&sh))
@@ -262,7 +263,8 @@ func (r *Reader) Uint64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint64 {
-			panic("Uint64slVal called on wrong slice")
+			r.wrongSlice(v, "Uint64slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]uint64)(unsafe.Pointer(&sh))
@@ -275,7 +277,8 @@ func (r *Reader) Int16slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int16 {
-			panic("Int16slVal called on wrong slice")
+			r.wrongSlice(v, "Int16slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]int16)(unsafe.Pointer(&sh))
@@ -288,7 +291,8 @@ func (r *Reader) Int32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int32 {
-			panic("Int32slVal called on wrong slice")
+			r.wrongSlice(v, "Int32slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]int32)(unsafe.Pointer(&sh))
@@ -301,7 +305,8 @@ func (r *Reader) Int64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int64 {
-			panic("Int64slVal called on wrong slice")
+			r.wrongSlice(v, "Int64slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]int64)(unsafe.Pointer(&sh))
@@ -314,7 +319,8 @@ func (r *Reader) Float32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Float32 {
-			panic("Float32slVal called on wrong slice")
+			r.wrongSlice(v, "Float32slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]float32)(unsafe.Pointer(&sh))
@@ -327,7 +333,8 @@ func (r *Reader) Float64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Float64 {
-			panic("Float64slVal called on wrong slice")
+			r.wrongSlice(v, "Float64slVal")
+			return
 		}
 		sh := sliceHeaderFromElem(el0, l)
 		p := *(*[]float64)(unsafe.Pointer(&sh))
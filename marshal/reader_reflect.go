@@ -2,7 +2,6 @@ package marshal
 
 import (
 	"fmt"
-	"log"
 	"reflect"
 	"strings"
 	"sync"
@@ -59,7 +58,7 @@ func (r *Reader) Read(i interface{}) error {
 			*o = r.String(int(count))
 		}
 	case *[]int8:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 1) {
 			*o = make([]int8, count)
 			r.Int8sl(*o)
 		}
@@ -68,42 +67,42 @@ func (r *Reader) Read(i interface{}) error {
 			*o = r.Slice(int(count))
 		}
 	case *[]int16:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 2) {
 			*o = make([]int16, count)
 			r.Int16sl(*o)
 		}
 	case *[]uint16:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 2) {
 			*o = make([]uint16, count)
 			r.Uint16sl(*o)
 		}
 	case *[]int32:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 4) {
 			*o = make([]int32, count)
 			r.Int32sl(*o)
 		}
 	case *[]uint32:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 4) {
 			*o = make([]uint32, count)
 			r.Uint32sl(*o)
 		}
 	case *[]int64:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 8) {
 			*o = make([]int64, count)
 			r.Int64sl(*o)
 		}
 	case *[]uint64:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 8) {
 			*o = make([]uint64, count)
 			r.Uint64sl(*o)
 		}
 	case *[]float32:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 4) {
 			*o = make([]float32, count)
 			r.Float32sl(*o)
 		}
 	case *[]float64:
-		if count = r.Uint32(); r.Err == nil {
+		if count = r.Uint32(); r.CheckCount(int(count), 8) {
 			*o = make([]float64, count)
 			r.Float64sl(*o)
 		}
@@ -281,7 +280,6 @@ func (r *Reader) ReadTail(i interface{}) error {
 	if r.Err != nil {
 		return r.Err
 	}
-	was := r.Body
 	switch o := i.(type) {
 	case *[]int8:
 		*o = make([]int8, len(r.Body))
@@ -342,8 +340,8 @@ func (r *Reader) ReadTail(i interface{}) error {
 			rd.Fixed(r, val)
 		}
 	}
-	if len(r.Body) != 0 {
-		r.Err = fmt.Errorf("Could not read into %+v whole [% x]", i, was)
+	if r.Err == nil && len(r.Body) != 0 {
+		r.Err = &TrailingBytesError{Left: len(r.Body)}
 	}
 	return r.Err
 }
@@ -393,6 +391,8 @@ type TReader struct {
 	Cnt        int
 	CntSet     func(reflect.Value, int) error
 	Flds       []FieldReader
+	/* Err is set when type could not be decoded, then readers just return it */
+	Err error
 }
 
 func (t *TReader) SetSize(v reflect.Value, sz int) (bool, error) {
@@ -450,6 +450,12 @@ func (t *TReader) WithSize(r *Reader, v reflect.Value, szrd func(*Reader) int) {
 		szrd = (*Reader).IntUint32
 	}
 	sz := szrd(r)
+	if r.Err != nil {
+		return
+	} else if sz < 0 || sz > len(r.Body) {
+		r.Err = &ShortBodyError{What: fmt.Sprintf("size %d", sz)}
+		return
+	}
 	if t.AutoSize != nil {
 		t.AutoSize(r, v, sz)
 		return
@@ -462,12 +468,11 @@ func (t *TReader) WithSize(r *Reader, v reflect.Value, szrd func(*Reader) int) {
 		return
 	}
 	rr := Reader{Body: r.Slice(sz), Err: r.Err}
-	was := rr.Body
 	t.Tail(&rr, v)
 	if rr.Err != nil {
 		r.Err = rr.Err
 	} else if len(rr.Body) != 0 {
-		r.Err = fmt.Errorf("Could not read size %d into %+v whole [% x]", sz, t, was)
+		r.Err = &TrailingBytesError{Left: len(rr.Body)}
 	}
 }
 
@@ -514,7 +519,7 @@ func (t *TReader) SetCount(v reflect.Value, cnt int) error {
 	} else if t.CntSet != nil {
 		return t.CntSet(v, cnt)
 	} else {
-		log.Panicf("Don't know what to do with count %+v", t)
+		return &UnsupportedTypeError{Type: t.Type, Reason: "count could not be set"}
 	}
 	return nil
 }
@@ -527,6 +532,9 @@ func (t *TReader) WithCount(r *Reader, v reflect.Value, cntrd func(*Reader) int)
 		cntrd = (*Reader).IntUint32
 	}
 	cnt := cntrd(r)
+	if !r.CheckCount(cnt, t.elemSize()) {
+		return
+	}
 	if t.AutoCount != nil {
 		t.AutoCount(r, v, cnt)
 		return
@@ -538,6 +546,17 @@ func (t *TReader) WithCount(r *Reader, v reflect.Value, cntrd func(*Reader) int)
 	t.Fixed(r, v)
 }
 
+/* elemSize is the least size of one element counted by cnt(), so malformed count fails before allocation */
+func (t *TReader) elemSize() int {
+	if t.Elem == nil {
+		return 1
+	}
+	if t.Elem.Sz >= 0 {
+		return t.Elem.Sz
+	}
+	return 1
+}
+
 func (t *TReader) fillautotail() {
 	if t.Fixed == nil && t.AutoCount != nil {
 		t.Fixed = func(r *Reader, v reflect.Value) {
@@ -765,6 +784,8 @@ func (t *TReader) Fill() {
 				rd.Tail(r, el)
 			}
 		}
+	default:
+		t.fail(&UnsupportedTypeError{Type: rt})
 	}
 	return
 }
@@ -969,7 +990,8 @@ func (sw *TReader) structFixed(r *Reader, v reflect.Value) {
 		} else if fs.CntRd != nil {
 			fs.WithCount(r, fv, fs.CntRd)
 		} else if fs.NoSize {
-			fs.Fixed(r, fv)
+			/* field without size consumes the rest of body */
+			fs.Tail(r, fv)
 		} else {
 			fs.Auto(r, fv)
 		}
@@ -1003,10 +1025,14 @@ Fields:
 		if fld.PkgPath != "" {
 			continue
 		}
+		badTag := func(reason string) {
+			t.fail(&BadTagError{Struct: rt, Field: fld.Name, Tag: fld.Tag, Reason: reason})
+		}
 		if nosize {
-			log.Panicf("Only last field could be marked as size(no) or cnt(no) %+v", rt)
+			badTag("only last field could be marked as size(no) or cnt(no)")
+			return
 		}
-		fr := FieldReader{I: i}
+		fr := FieldReader{I: i, Tag: fld.Tag}
 		ipro := fld.Tag.Get("iproto")
 		var ber bool
 
@@ -1055,7 +1081,8 @@ Fields:
 					nosize = true
 					fr.NoSize = true
 				default:
-					log.Panicf("Could not understand directive size(%s) for field %s", t, fld.Name)
+					badTag("could not understand directive size(" + t + ")")
+					return
 				}
 			} else if strings.HasPrefix(m, "cnt(") {
 				if fr.TReader == nil {
@@ -1096,18 +1123,24 @@ Fields:
 					nosize = true
 					fr.NoSize = true
 				default:
-					log.Panicf("Could not understand directive cnt(%s) for field %s", t, fld.Name)
+					badTag("could not understand directive cnt(" + t + ")")
+					return
 				}
 			}
 		}
 
 		if fr.CntRd != nil && fr.SzRd != nil {
-			log.Panicf("Sorry, but you shall not use both size() and cnt() iproto tag directive for field %s", fld.Name)
+			badTag("size() and cnt() could not be used together")
+			return
 		}
 
 		if fr.TReader == nil {
 			fr.TReader = _reader(fld.Type)
 		}
+		if fr.Err != nil {
+			t.fail(fr.Err)
+			return
+		}
 
 		if fr.Sz == 0 && fr.CntRd == nil && fr.SzRd == nil {
 			continue
@@ -1135,7 +1168,8 @@ Fields:
 					fr.TReader.FillArray()
 					fr.TReader.fillautotail()
 				default:
-					log.Panicf("Could not apply 'ber' for array [%d]%+v", fld.Type.Len(), fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			case reflect.Slice:
 				switch fld.Type.Elem().Kind() {
@@ -1151,7 +1185,8 @@ Fields:
 					fr.TReader.FillSlice()
 					fr.TReader.fillautotail()
 				default:
-					log.Panicf("Could not apply 'ber' for slice []%+v", fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			case reflect.Ptr:
 				switch fld.Type.Elem().Kind() {
@@ -1164,10 +1199,12 @@ Fields:
 					fr.TReader.FillPtr()
 					fr.TReader.fillautotail()
 				default:
-					log.Panicf("Could not apply 'ber' for ptr *%+v", fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			default:
-				log.Panicf("Could not apply 'ber' for type %+v", fld.Type)
+				badTag("ber could be applied only to unsigned integers")
+				return
 			}
 		}
 		t.Flds = append(t.Flds, fr)
@@ -1196,7 +1233,7 @@ func (r Reader) Error() error {
 	if r.Err != nil {
 		return r.Err
 	} else if len(r.Body) > 0 {
-		return fmt.Errorf("Unparsed body: [% x]", r.Body)
+		return &TrailingBytesError{Left: len(r.Body)}
 	}
 	return nil
 }
@@ -15,6 +15,8 @@ const (
 type Writer struct {
 	buf     []byte
 	DefSize int
+	/* Err is set when value could not be encoded, e.g. its type is not supported */
+	Err error
 }
 
 func (w *Writer) Written() (res []byte) {
@@ -26,9 +28,16 @@ func (w *Writer) Written() (res []byte) {
 
 func (w *Writer) Reset() {
 	w.buf = w.buf[:0]
+	w.Err = nil
 	return
 }
 
+func (w *Writer) setErr(err error) {
+	if w.Err == nil {
+		w.Err = err
+	}
+}
+
 func ceilLog(n int) int {
 	if n > 0 {
 		n = (n - 1) >> 2
@@ -79,7 +88,7 @@ func (w *Writer) Int8(i int8) {
 }
 
 func varu64size(i uint64) (j int) {
-	for j = 0; i > 1<<7; j++ {
+	for j = 0; i >= 1<<7; j++ {
 		i >>= 7
 	}
 	return j + 1
@@ -227,7 +236,8 @@ func (w *Writer) Uint8slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint8 {
-			panic("Uint8slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Uint8slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -246,7 +256,8 @@ func (w *Writer) Int8slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int8 {
-			panic("Int8slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Int8slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -113,7 +113,7 @@ func (w *Writer) Float32sl(i []float32) {
 func (w *Writer) Float64sl(i []float64) {
 	l := w.ensure(len(i) * 8)
 	for j := 0; j < len(i); j++ {
-		le.PutUint64(w.buf[l+j*4:], math.Float64bits(i[j]))
+		le.PutUint64(w.buf[l+j*8:], math.Float64bits(i[j]))
 	}
 	return
 }
@@ -123,7 +123,8 @@ func (w *Writer) Uint16slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint16 {
-			panic("Uint16slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Uint16slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -142,7 +143,8 @@ func (w *Writer) Uint32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint32 {
-			panic("Uint32slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Uint32slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -161,7 +163,8 @@ func (w *Writer) Uint64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Uint64 {
-			panic("Uint64slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Uint64slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -180,7 +183,8 @@ func (w *Writer) Int16slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int16 {
-			panic("Int16slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Int16slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -199,7 +203,8 @@ func (w *Writer) Int32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int32 {
-			panic("Int32slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Int32slVal called on wrong slice"})
+			return
 		}
 		if el0 := v.Index(0); el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -218,7 +223,8 @@ func (w *Writer) Int64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Int64 {
-			panic("Int64slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Int64slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -237,7 +243,8 @@ func (w *Writer) Float32slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Float32 {
-			panic("Float32slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Float32slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -256,7 +263,8 @@ func (w *Writer) Float64slVal(v reflect.Value) {
 	if l > 0 {
 		el0 := v.Index(0)
 		if el0.Kind() != reflect.Float64 {
-			panic("Float64slVal called on wrong slice")
+			w.setErr(&UnsupportedTypeError{Type: v.Type(), Reason: "Float64slVal called on wrong slice"})
+			return
 		}
 		if el0.CanAddr() {
 			sh := sliceHeaderFromElem(el0, l)
@@ -1,7 +1,6 @@
 package marshal
 
 import (
-	"log"
 	"reflect"
 	"strings"
 	"sync"
@@ -264,11 +263,14 @@ type TWriter struct {
 	Cnt        int
 	CntGet     func(reflect.Value) int
 	Flds       []FieldWriter
+	/* Err is set when type could not be encoded, then writers just set it */
+	Err error
 }
 
 var twriters = make(chan *Writer, 512)
 
 func puttwriter(w *Writer) {
+	w.Err = nil
 	select {
 	case twriters <- w:
 	default:
@@ -319,6 +321,9 @@ func (t *TWriter) WithSize(w *Writer, v reflect.Value, szwr func(*Writer, int))
 		body := tw.Written()
 		szwr(w, len(body))
 		w.Bytes(body)
+		if tw.Err != nil {
+			w.setErr(tw.Err)
+		}
 		puttwriter(tw)
 	}
 }
@@ -346,12 +351,15 @@ func (t *TWriter) Count(v reflect.Value) int {
 			return cnt
 		}
 	}
-	log.Panicf("could not determine count %+v %+v", t, v.Interface())
 	return -1
 }
 
 func (t *TWriter) WithCount(w *Writer, v reflect.Value, cntwr func(*Writer, int)) {
 	cnt := t.Count(v)
+	if cnt < 0 {
+		w.setErr(&UnsupportedTypeError{Type: t.Type, Reason: "could not determine count"})
+		return
+	}
 	if cntwr == nil {
 		cntwr = (*Writer).IntUint32
 	}
@@ -525,6 +533,8 @@ func (t *TWriter) Fill() {
 			Sz:  -1,
 			Cnt: -1,
 		}
+	default:
+		t.fail(&UnsupportedTypeError{Type: rt})
 	}
 	return
 }
@@ -698,8 +708,12 @@ Fields:
 		if fld.PkgPath != "" {
 			continue
 		}
+		badTag := func(reason string) {
+			t.fail(&BadTagError{Struct: rt, Field: fld.Name, Tag: fld.Tag, Reason: reason})
+		}
 		if nosize {
-			log.Panicf("Only last field could be marked as size(no) or cnt(no) %+v", rt)
+			badTag("only last field could be marked as size(no) or cnt(no)")
+			return
 		}
 		ipro := fld.Tag.Get("iproto")
 		fw := FieldWriter{I: i, Tag: fld.Tag}
@@ -750,7 +764,8 @@ Fields:
 					nosize = true
 					fw.NoSize = true
 				default:
-					log.Panicf("Could not understand directive size(%s) for field %s", t, fld.Name)
+					badTag("could not understand directive size(" + t + ")")
+					return
 				}
 			} else if strings.HasPrefix(m, "cnt(") {
 				if fw.TWriter == nil {
@@ -791,18 +806,24 @@ Fields:
 					nosize = true
 					fw.NoSize = true
 				default:
-					log.Panicf("Could not understand directive cnt(%s) for field %s", t, fld.Name)
+					badTag("could not understand directive cnt(" + t + ")")
+					return
 				}
 			}
 		}
 
 		if fw.CntWr != nil && fw.SzWr != nil {
-			log.Panicf("Sorry, but you shall not use both size() and cnt() iproto tag directive for field %s", fld.Name)
+			badTag("size() and cnt() could not be used together")
+			return
 		}
 
 		if fw.TWriter == nil {
 			fw.TWriter = _writer(fld.Type)
 		}
+		if fw.Err != nil {
+			t.fail(fw.Err)
+			return
+		}
 
 		if fw.Sz == 0 && fw.CntWr == nil && fw.SzWr == nil {
 			continue
@@ -823,14 +844,16 @@ Fields:
 					*fw.TWriter = *BerSlWriter
 					fw.TWriter.Type = fld.Type
 				default:
-					log.Panicf("Could not apply 'ber' for array [%d]%+v", fld.Type.Len(), fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			case reflect.Slice:
 				switch fld.Type.Elem().Kind() {
 				case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 					fw.TWriter = BerSlWriter
 				default:
-					log.Panicf("Could not apply 'ber' for slice []%+v", fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			case reflect.Ptr:
 				switch fld.Type.Elem().Kind() {
@@ -842,10 +865,12 @@ Fields:
 					}
 					fw.TWriter.FillPtr()
 				default:
-					log.Panicf("Could not apply 'ber' for ptr *%+v", fld.Type.Elem())
+					badTag("ber could be applied only to unsigned integers")
+					return
 				}
 			default:
-				log.Panicf("Could not apply 'ber' for type %+v", fld.Type)
+				badTag("ber could be applied only to unsigned integers")
+				return
 			}
 		}
 		t.Flds = append(t.Flds, fw)
@@ -0,0 +1,312 @@
+// Package metrics collects request statistics of iproto services and end points
+// and exposes them in Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency histogram buckets in seconds
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is a registry used by package level helpers
+var Default = NewRegistry()
+
+type Registry struct {
+	m        sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+type metricType string
+
+const (
+	counterType   = metricType("counter")
+	gaugeType     = metricType("gauge")
+	histogramType = metricType("histogram")
+)
+
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+
+	m      sync.Mutex
+	series map[string]*series
+	gauges []gaugeFunc
+}
+
+type series struct {
+	values  []string
+	count   uint64
+	sum     uint64
+	buckets []uint64
+}
+
+type gaugeFunc struct {
+	labels Labels
+	f      func() float64
+}
+
+// Labels are constant labels of a gauge
+type Labels map[string]string
+
+func (reg *Registry) family(name, help string, typ metricType, buckets []float64, labels []string) *family {
+	reg.m.Lock()
+	defer reg.m.Unlock()
+	if f := reg.byName[name]; f != nil {
+		if f.typ != typ || len(f.labels) != len(labels) {
+			log.Panicf("metric %s already registered as %s with labels %v", name, f.typ, f.labels)
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	reg.families = append(reg.families, f)
+	reg.byName[name] = f
+	return f
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		log.Panicf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// lookup returns series or nil, it does not create series, so reading absent one does not export it
+func (f *family) lookup(values []string) *series {
+	key := f.key(values)
+	f.m.Lock()
+	s := f.series[key]
+	f.m.Unlock()
+	return s
+}
+
+func (f *family) get(values []string) *series {
+	key := f.key(values)
+	f.m.Lock()
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		if f.typ == histogramType {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	f.m.Unlock()
+	return s
+}
+
+// Counter is a family of monotonically increasing counters, one per set of label values
+type Counter struct {
+	f *family
+}
+
+// Counter registers counter family or returns already registered one
+func (reg *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{f: reg.family(name, help, counterType, nil, labels)}
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(n uint64, values ...string) {
+	atomic.AddUint64(&c.f.get(values).count, n)
+}
+
+// Value returns current value of counter
+func (c *Counter) Value(values ...string) uint64 {
+	if s := c.f.lookup(values); s != nil {
+		return atomic.LoadUint64(&s.count)
+	}
+	return 0
+}
+
+// Histogram is a family of histograms with same buckets, one per set of label values
+type Histogram struct {
+	f *family
+}
+
+// Histogram registers histogram family or returns already registered one.
+// buckets should be sorted, DefBuckets are used when buckets is nil.
+func (reg *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	return &Histogram{f: reg.family(name, help, histogramType, buckets, labels)}
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	s := h.f.get(values)
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.buckets) {
+		atomic.AddUint64(&s.buckets[i], 1)
+	}
+	for {
+		old := atomic.LoadUint64(&s.sum)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&s.sum, old, sum) {
+			break
+		}
+	}
+	atomic.AddUint64(&s.count, 1)
+}
+
+// Count returns number of observations
+func (h *Histogram) Count(values ...string) uint64 {
+	if s := h.f.lookup(values); s != nil {
+		return atomic.LoadUint64(&s.count)
+	}
+	return 0
+}
+
+// GaugeFunc registers gauge which value is taken from f on every scrape.
+// Several gauges with different labels may share one name.
+func (reg *Registry) GaugeFunc(name, help string, labels Labels, f func() float64) {
+	fam := reg.family(name, help, gaugeType, nil, nil)
+	fam.m.Lock()
+	fam.gauges = append(fam.gauges, gaugeFunc{labels: labels, f: f})
+	fam.m.Unlock()
+}
+
+// ServeHTTP writes all metrics in Prometheus text exposition format
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	reg.WriteText(w)
+}
+
+// WriteText writes all metrics in Prometheus text exposition format
+func (reg *Registry) WriteText(w io.Writer) error {
+	reg.m.Lock()
+	families := make([]*family, len(reg.families))
+	copy(families, reg.families)
+	reg.m.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.m.Lock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	series := make([]*series, len(keys))
+	for i, k := range keys {
+		series[i] = f.series[k]
+	}
+	gauges := make([]gaugeFunc, len(f.gauges))
+	copy(gauges, f.gauges)
+	f.m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, g := range gauges {
+		names := make([]string, 0, len(g.labels))
+		for k := range g.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, k := range names {
+			values[i] = g.labels[k]
+		}
+		writeSample(w, f.name, names, values, "", "", g.f())
+	}
+	for _, s := range series {
+		switch f.typ {
+		case counterType:
+			writeSample(w, f.name, f.labels, s.values, "", "", float64(atomic.LoadUint64(&s.count)))
+		case histogramType:
+			var cum uint64
+			for i, le := range f.buckets {
+				cum += atomic.LoadUint64(&s.buckets[i])
+				writeSample(w, f.name+"_bucket", f.labels, s.values, "le", formatFloat(le), float64(cum))
+			}
+			count := atomic.LoadUint64(&s.count)
+			writeSample(w, f.name+"_bucket", f.labels, s.values, "le", "+Inf", float64(count))
+			writeSample(w, f.name+"_sum", f.labels, s.values, "", "", math.Float64frombits(atomic.LoadUint64(&s.sum)))
+			writeSample(w, f.name+"_count", f.labels, s.values, "", "", float64(count))
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extra, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l)
+			w.WriteString(`="`)
+			w.WriteString(escapeValue(values[i]))
+			w.WriteByte('"')
+		}
+		if extra != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueEscaper.Replace(s)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type %q", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func expectLines(t *testing.T, text string, lines ...string) {
+	for _, l := range lines {
+		if !strings.Contains(text, l+"\n") {
+			t.Errorf("scrape has no line %q:\n%s", l, text)
+		}
+	}
+}
+
+func TestScrape(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Counter("test_total", "Test counter.", "kind")
+	c.Inc("a")
+	c.Add(2, "a")
+	c.Inc(`b"\`)
+	h := reg.Histogram("test_seconds", "Test histogram.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	reg.GaugeFunc("test_gauge", "Test gauge.", Labels{"y": "2", "x": "1"}, func() float64 { return 7 })
+
+	expectLines(t, scrape(t, reg),
+		"# HELP test_total Test counter.",
+		"# TYPE test_total counter",
+		`test_total{kind="a"} 3`,
+		`test_total{kind="b\"\\"} 1`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		`test_seconds_sum 5.55`,
+		`test_seconds_count 3`,
+		"# TYPE test_gauge gauge",
+		`test_gauge{x="1",y="2"} 7`,
+	)
+}
+
+func TestWrap(t *testing.T) {
+	reg := NewRegistry()
+	serv := reg.Wrap("echo", iproto.SF(func(r *iproto.Request) {
+		if r.Msg == 2 {
+			r.RespondBytes(iproto.RcFatal|0x100, nil)
+		} else {
+			r.RespondBytes(iproto.RcOK, r.Body)
+		}
+	}))
+	for i := 0; i < 3; i++ {
+		iproto.CallMsgBody(serv, 1, iproto.Body{1})
+	}
+	iproto.CallMsgBody(serv, 2, iproto.Body{1})
+
+	expectLines(t, scrape(t, reg),
+		`iproto_responses_total{service="echo",msg="1",code="0x0"} 3`,
+		`iproto_responses_total{service="echo",msg="2",code="0x102"} 1`,
+		`iproto_request_duration_seconds_count{service="echo",msg="1"} 3`,
+		`iproto_request_duration_seconds_bucket{service="echo",msg="2",le="+Inf"} 1`,
+	)
+}
+
+func TestRegisterPoint(t *testing.T) {
+	reg := NewRegistry()
+	var p iproto.SimplePoint
+	reg.RegisterPoint("p", &p)
+	expectLines(t, scrape(t, reg), `iproto_point_queue_length{point="p"} 0`)
+}
+
+func TestValueDoesNotCreateSeries(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Counter("test_total", "Test counter.", "kind")
+	h := reg.Histogram("test_seconds", "Test histogram.", nil, "kind")
+	c.Inc("a")
+	if v := c.Value("a"); v != 1 {
+		t.Errorf("counter value %d", v)
+	}
+	if v, n := c.Value("b"), h.Count("b"); v != 0 || n != 0 {
+		t.Errorf("absent series gives %d and %d", v, n)
+	}
+	if text := scrape(t, reg); strings.Contains(text, `kind="b"`) {
+		t.Errorf("reading absent series exports it:\n%s", text)
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+const (
+	durationName  = "iproto_request_duration_seconds"
+	responsesName = "iproto_responses_total"
+)
+
+// Wrap returns service, which records latency histogram per RequestType and
+// counter of response codes per RequestType for every request sent to s.
+func (reg *Registry) Wrap(name string, s iproto.Service) iproto.Service {
+	duration := reg.Histogram(durationName, "Latency of iproto requests.", nil, "service", "msg")
+	responses := reg.Counter(responsesName, "Count of iproto responses by return code.", "service", "msg", "code")
+	return iproto.StatWrap(s, func(r *iproto.Request, d time.Duration) {
+		msg := strconv.FormatUint(uint64(r.Msg), 10)
+		var code iproto.RetCode
+		if r.Response != nil {
+			code = r.Response.Code
+		}
+		duration.Observe(d.Seconds(), name, msg)
+		responses.Inc(name, msg, "0x"+strconv.FormatUint(uint64(code), 16))
+	})
+}
+
+// RegisterPoint exports queue length of end point
+func (reg *Registry) RegisterPoint(name string, p *iproto.SimplePoint) {
+	reg.GaugeFunc("iproto_point_queue_length", "Requests waiting in end point queue.",
+		Labels{"point": name}, func() float64 { return float64(p.QueueLen()) })
+}
+
+// RegisterClient exports queue length and number of requests in fly of client server
+func (reg *Registry) RegisterClient(name string, s *client.Server) {
+	reg.RegisterPoint(name, &s.SimplePoint)
+	reg.GaugeFunc("iproto_client_in_fly", "Requests sent to server and not yet answered.",
+		Labels{"server": name}, func() float64 { return float64(s.InFly()) })
+}
+
+// RegisterServer exports number of connections and requests in fly of iproto server
+func (reg *Registry) RegisterServer(name string, s *server.Server) {
+	reg.GaugeFunc("iproto_server_connections", "Accepted connections.",
+		Labels{"server": name}, func() float64 { return float64(s.Connections()) })
+	reg.GaugeFunc("iproto_server_in_fly", "Requests read from connections and not yet answered.",
+		Labels{"server": name}, func() float64 { return float64(s.InFly()) })
+}
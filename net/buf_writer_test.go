@@ -0,0 +1,18 @@
+package net
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufWriterWriteByte(t *testing.T) {
+	var b bytes.Buffer
+	w := BufWriter{w: &b}
+	w.WriteByte(1)
+	w.WriteByte(2)
+	w.WriteUint32(0x06050403)
+	w.Flush()
+	if !bytes.Equal(b.Bytes(), []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("written [% x]", b.Bytes())
+	}
+}
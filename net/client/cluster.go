@@ -0,0 +1,202 @@
+package client
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// Resolver returns current set of addresses of a service
+type Resolver interface {
+	Resolve() ([]string, error)
+}
+
+// Watcher could be implemented by Resolver to notify Cluster about changes between polls
+type Watcher interface {
+	Changes() <-chan struct{}
+}
+
+var DefaultResolveInterval = 30 * time.Second
+var DefaultDrainTimeout = 5 * time.Second
+
+type ClusterConfig struct {
+	// Server is a template for servers of cluster, Address is replaced with resolved one
+	Server ServerConfig
+
+	Resolver Resolver
+	// Interval is a period of polling Resolver, DefaultResolveInterval by default
+	Interval time.Duration
+
+	// Strategy balances requests among live servers, RoundRobin by default
+	Strategy iproto.BalanceStrategy
+
+	// DrainTimeout limits time removed server is waited to answer requests already sent to it,
+	// DefaultDrainTimeout by default
+	DrainTimeout time.Duration
+}
+
+// Cluster balances requests among servers which addresses are returned by Resolver.
+// New addresses get new Server, servers with vanished addresses are drained and stopped.
+// If Resolver fails or returns no addresses, current set of servers is kept.
+type Cluster struct {
+	iproto.BalancerPoint
+	conf ClusterConfig
+
+	m        sync.Mutex
+	servers  map[string]*Server
+	watching bool
+
+	quit      chan struct{}
+	watchDone chan struct{}
+	stopOnce  sync.Once
+}
+
+var _ iproto.EndPoint = (*Cluster)(nil)
+
+func (cfg ClusterConfig) NewCluster() (c *Cluster) {
+	if cfg.Resolver == nil {
+		log.Panic("Could not init client.Cluster without resolver")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultResolveInterval
+	}
+	if cfg.Strategy == nil {
+		cfg.Strategy = &iproto.RoundRobin{}
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+	c = &Cluster{
+		conf:      cfg,
+		servers:   make(map[string]*Server),
+		quit:      make(chan struct{}),
+		watchDone: make(chan struct{}),
+	}
+	c.Strategy = cfg.Strategy
+	c.Timeout = cfg.Server.Timeout
+	c.SimplePoint.Init(c)
+	return
+}
+
+func (c *Cluster) Loop() {
+	c.resolve()
+	c.m.Lock()
+	c.watching = true
+	c.m.Unlock()
+	go c.watch()
+	c.BalancerPoint.Loop()
+}
+
+// Stop stops watching resolver and all servers. Second call does nothing.
+func (c *Cluster) Stop() {
+	c.stopOnce.Do(c.stop)
+}
+
+func (c *Cluster) stop() {
+	close(c.quit)
+	if !c.Runned() {
+		return
+	}
+	c.m.Lock()
+	watching := c.watching
+	c.m.Unlock()
+	/* if Loop is not there yet, watcher will see quit closed at once */
+	if watching {
+		<-c.watchDone
+	}
+	c.BalancerPoint.Stop()
+}
+
+// Servers returns sorted addresses of current servers
+func (c *Cluster) Servers() []string {
+	c.m.Lock()
+	addrs := make([]string, 0, len(c.servers))
+	for addr := range c.servers {
+		addrs = append(addrs, addr)
+	}
+	c.m.Unlock()
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Server returns server for address, or nil if address is not in cluster
+func (c *Cluster) Server(addr string) *Server {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.servers[addr]
+}
+
+func (c *Cluster) watch() {
+	defer close(c.watchDone)
+	var changes <-chan struct{}
+	if w, ok := c.conf.Resolver.(Watcher); ok {
+		changes = w.Changes()
+	}
+	t := time.NewTicker(c.conf.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-t.C:
+		case <-changes:
+		}
+		c.resolve()
+	}
+}
+
+func (c *Cluster) resolve() {
+	addrs, err := c.conf.Resolver.Resolve()
+	if err != nil {
+		log.Printf("Cluster %s: resolve failed: %v", c.conf.Server.Name, err)
+		return
+	}
+	if len(addrs) == 0 {
+		/* removing every server is more likely resolver's glitch than real change */
+		log.Printf("Cluster %s: resolver returned no addresses, keeping %d servers", c.conf.Server.Name, len(c.Servers()))
+		return
+	}
+	c.update(addrs)
+}
+
+func (c *Cluster) update(addrs []string) {
+	fresh := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		fresh[addr] = true
+	}
+
+	var removed []*Server
+	c.m.Lock()
+	for addr, serv := range c.servers {
+		if !fresh[addr] {
+			delete(c.servers, addr)
+			removed = append(removed, serv)
+		}
+	}
+	var added []*Server
+	for addr := range fresh {
+		if _, ok := c.servers[addr]; !ok {
+			conf := c.conf.Server
+			conf.Address = addr
+			if conf.Name != "" {
+				conf.Name += "/" + addr
+			}
+			serv := conf.NewServer()
+			c.servers[addr] = serv
+			added = append(added, serv)
+		}
+	}
+	c.m.Unlock()
+
+	for _, serv := range added {
+		log.Printf("Cluster: adding %s", serv.Name())
+		c.AddChild(serv)
+	}
+	for _, serv := range removed {
+		log.Printf("Cluster: removing %s", serv.Name())
+		c.RemoveChild(serv, c.conf.DrainTimeout)
+	}
+}
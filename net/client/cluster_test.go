@@ -0,0 +1,183 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/memnet"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+type fakeResolver struct {
+	m       sync.Mutex
+	addrs   []string
+	changes chan struct{}
+}
+
+func (f *fakeResolver) Resolve() ([]string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return append([]string(nil), f.addrs...), nil
+}
+
+func (f *fakeResolver) Changes() <-chan struct{} {
+	return f.changes
+}
+
+func (f *fakeResolver) set(addrs ...string) {
+	f.m.Lock()
+	f.addrs = addrs
+	f.m.Unlock()
+	f.changes <- struct{}{}
+}
+
+/* memServer answers with its name, requests with Msg 2 are held */
+func memServer(t *testing.T, name string, held chan *iproto.Request) *server.Server {
+	ep := iproto.SF(func(r *iproto.Request) {
+		if r.Msg == 2 {
+			held <- r
+			return
+		}
+		r.Respond(iproto.RcOK, iproto.Body(name))
+	})
+	serv := (&server.Config{Network: "mem", Address: name, EndPoint: ep, Listen: memnet.Listen}).NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return serv
+}
+
+func waitServers(t *testing.T, c *Cluster, addrs ...string) {
+	for i := 0; !reflect.DeepEqual(c.Servers(), addrs); i++ {
+		if i == 100 {
+			t.Fatalf("expected servers %v, got %v", addrs, c.Servers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	heldA := make(chan *iproto.Request, 1)
+	a := memServer(t, "cluster-a", heldA)
+	defer a.Shutdown(0)
+	heldB := make(chan *iproto.Request, 1)
+	b := memServer(t, "cluster-b", heldB)
+	defer b.Shutdown(0)
+
+	res := &fakeResolver{addrs: []string{"cluster-a"}, changes: make(chan struct{})}
+	c := ClusterConfig{
+		Server:   ServerConfig{Network: "mem", Timeout: time.Second, Dialer: &memnet.Dialer{}},
+		Resolver: res,
+		Interval: time.Hour,
+	}.NewCluster()
+	iproto.Run(c)
+	defer c.Stop()
+
+	waitServers(t, c, "cluster-a")
+	res.set("cluster-a", "cluster-b")
+	waitServers(t, c, "cluster-a", "cluster-b")
+
+	seen := make(map[string]int)
+	for i := 0; len(seen) < 2 && i < 100; i++ {
+		r := iproto.CallMsgBody(c, 1, nil)
+		if r.Code == iproto.RcOK {
+			seen[string(r.Body)]++
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("requests should be balanced to both servers, got %v", seen)
+	}
+
+	/* hold request on a, and remove a: request should still be answered */
+	var req *iproto.Request
+	var ch iproto.Chan
+	for req == nil {
+		_, ch = iproto.SendMsgBody(c, 2, nil)
+		select {
+		case req = <-heldA:
+		case r := <-heldB:
+			r.Respond(iproto.RcOK, nil)
+			<-ch
+		case <-time.After(time.Second):
+			t.Fatal("request was not received")
+		}
+	}
+	removed := c.Server("cluster-a")
+	res.set("cluster-b")
+	waitServers(t, c, "cluster-b")
+	for i := 0; i < 10; i++ {
+		if r := iproto.CallMsgBody(c, 1, nil); r.Code != iproto.RcOK || string(r.Body) != "cluster-b" {
+			t.Fatalf("request to removed server: %x %q", r.Code, r.Body)
+		}
+	}
+	if removed.Stopped() {
+		t.Errorf("removed server should be drained before stop")
+	}
+	req.Respond(iproto.RcOK, nil)
+	if r := <-ch; r.Code != iproto.RcOK {
+		t.Errorf("request to draining server answered with %x", r.Code)
+	}
+	for i := 0; !removed.Stopped(); i++ {
+		if i == 100 {
+			t.Fatalf("drained server should be stopped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	/* empty result is transient, servers are kept */
+	res.set()
+	res.changes <- struct{}{}
+	if addrs := c.Servers(); !reflect.DeepEqual(addrs, []string{"cluster-b"}) {
+		t.Errorf("empty resolve result changes servers to %v", addrs)
+	}
+}
+
+func stopTwice(t *testing.T, c *Cluster, what string) {
+	done := make(chan struct{})
+	go func() {
+		c.Stop()
+		c.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Stop of cluster %s blocks", what)
+	}
+}
+
+func TestClusterStop(t *testing.T) {
+	stopTwice(t, ClusterConfig{Resolver: &fakeResolver{}}.NewCluster(), "which were not run")
+	c := ClusterConfig{Resolver: &fakeResolver{}}.NewCluster()
+	iproto.Run(c)
+	stopTwice(t, c, "stopped twice")
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iproto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "servers")
+	ioutil.WriteFile(path, []byte("# servers\n127.0.0.1:1\n\n 127.0.0.1:2 \n"), 0644)
+
+	f := &FileResolver{Path: path}
+	if addrs, err := f.Resolve(); err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1:1", "127.0.0.1:2"}) {
+		t.Fatalf("resolved %v %v", addrs, err)
+	}
+	ioutil.WriteFile(path, []byte("127.0.0.1:3\n"), 0644)
+	if addrs, err := f.Resolve(); err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1:3"}) {
+		t.Fatalf("file change is not noticed: %v %v", addrs, err)
+	}
+	os.Remove(path)
+	if _, err := f.Resolve(); err == nil {
+		t.Errorf("missing file should fail")
+	}
+}
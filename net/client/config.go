@@ -1,11 +1,14 @@
 package client
 
 import (
+	"crypto/tls"
 	"log"
+	stdnet "net"
 	"strings"
 	"time"
 
 	"github.com/funny-falcon/go-iproto/net"
+	"github.com/funny-falcon/go-iproto/net/client/connection"
 )
 
 type ServerConfig struct {
@@ -23,9 +26,22 @@ type ServerConfig struct {
 
 	RetCodeType net.RCType
 
+	// MaxBodySize limits body length of response, connection receiving longer one is closed.
+	// net.DefaultMaxBodySize is used if it is zero.
+	MaxBodySize int
+
 	Timeout time.Duration
+
+	// TLS enables TLS. Put client certificates into TLS.Certificates for mutual TLS.
+	// If TLS.ServerName is empty, it is taken from Address.
+	TLS *tls.Config
+
+	// Dialer is used to establish connections, by default it is net.Dialer with DialTimeout
+	Dialer Dialer
 }
 
+type Dialer = connection.Dialer
+
 var DefaultReadTimeout = 30 * time.Second
 var DefaultWriteTimeout = 30 * time.Second
 var DefaultPingInterval = 1 * time.Second
@@ -56,6 +72,15 @@ func (cfg *ServerConfig) SetDefaults() *ServerConfig {
 		cfg.PingInterval = DefaultPingInterval
 	}
 
+	if cfg.TLS != nil && cfg.TLS.ServerName == "" && !cfg.TLS.InsecureSkipVerify {
+		host, _, err := stdnet.SplitHostPort(cfg.Address)
+		if err != nil {
+			host = cfg.Address
+		}
+		cfg.TLS = cfg.TLS.Clone()
+		cfg.TLS.ServerName = host
+	}
+
 	if cfg.DialTimeout == 0 {
 		cfg.DialTimeout = 5 * time.Second
 	}
@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"crypto/tls"
 	"io"
 	"log"
 	"net"
@@ -46,6 +47,11 @@ const (
 	CsClosed = CsReadClosed | CsWriteClosed
 )
 
+// Dialer establishes connections to server. *net.Dialer implements it.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
 type CConf struct {
 	Network string
 	Address string
@@ -56,6 +62,10 @@ type CConf struct {
 	DialTimeout  time.Duration
 
 	RetCodeType nt.RCType
+	MaxBodySize int
+
+	TLS    *tls.Config
+	Dialer Dialer
 
 	ConnErr chan<- Error
 }
@@ -89,6 +99,7 @@ func NewConnection(conf *CConf, id uint64) (conn *Connection) {
 		CConf: conf,
 		Id:    id,
 
+		closeWrite: make(chan bool),
 		loopNotify: make(chan notifyAction, 2),
 		State:      CsNew,
 	}
@@ -100,15 +111,31 @@ func NewConnection(conf *CConf, id uint64) (conn *Connection) {
 /* default 5 seconds interval for Connection */
 const DialTimeout = 5 * time.Second
 
+func (conn *Connection) dialTimeout() time.Duration {
+	if conn.DialTimeout > 0 {
+		return conn.DialTimeout
+	}
+	return DialTimeout
+}
+
 func (conn *Connection) Loop() {
-	dialer := net.Dialer{Timeout: DialTimeout}
+	dialer := conn.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: conn.dialTimeout()}
+	}
 	conn.State = CsDialing
 	if netconn, err := dialer.Dial(conn.Network, conn.Address); err != nil {
 		conn.ConnErr <- Error{conn, Dial, err}
 		conn.State = CsClosed
 	} else {
-		conn.conn = netconn.(nt.NetConn)
+		if conn.conn, err = conn.wrap(netconn); err != nil {
+			netconn.Close()
+			conn.ConnErr <- Error{conn, Dial, err}
+			conn.State = CsClosed
+			return
+		}
 		conn.reader.Init(conn.conn, conn.ReadTimeout, conn.RetCodeType)
+		conn.reader.MaxBodySize = conn.MaxBodySize
 		conn.writer.Init(conn.conn, conn.WriteTimeout, conn.RetCodeType)
 		if err = conn.writer.Ping(); err == nil {
 			if err = conn.writer.Flush(); err == nil {
@@ -129,7 +156,26 @@ func (conn *Connection) Loop() {
 	}
 }
 
-/* RunWithConn is for testing purposes */
+// InFly returns number of requests sent to connection and not yet answered
+func (conn *Connection) InFly() int {
+	return int(conn.inFly.count())
+}
+
+func (conn *Connection) wrap(netconn net.Conn) (nt.NetConn, error) {
+	if conn.TLS == nil {
+		return nt.WrapConn(netconn), nil
+	}
+	tc := tls.Client(netconn, conn.TLS)
+	tc.SetDeadline(time.Now().Add(conn.dialTimeout()))
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	tc.SetDeadline(time.Time{})
+	return nt.NewTLSConn(tc, netconn), nil
+}
+
+// RunWithConn runs connection over already established netconn.
+// Deprecated: set CConf.Dialer instead, it allows reconnects.
 func (conn *Connection) RunWithConn(netconn io.ReadWriteCloser) {
 	switch nc := netconn.(type) {
 	case nt.NetConn:
@@ -165,6 +211,8 @@ func (conn *Connection) controlLoop() {
 			conn.State &= CsClosed
 			conn.State |= CsReadClosed
 			if conn.State&CsWriteClosed == 0 {
+				/* nothing will be answered anymore, so writeLoop should stop to flush in fly requests */
+				close(conn.closeWrite)
 				conn.conn.CloseWrite()
 			}
 		case readEmpty:
@@ -277,6 +325,8 @@ Loop:
 			case <-conn.ExitChan():
 				conn.shutdown = true
 				break Loop
+			case <-conn.closeWrite:
+				break Loop
 			}
 		}
 
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	stdnet "net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticResolver always returns same addresses
+type StaticResolver []string
+
+func (s StaticResolver) Resolve() ([]string, error) {
+	return append([]string(nil), s...), nil
+}
+
+var DefaultLookupTimeout = 5 * time.Second
+
+func lookupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), DefaultLookupTimeout)
+}
+
+// SRVResolver resolves addresses from DNS SRV records of _Service._Proto.Name.
+// If Service and Proto are empty, Name is looked up directly.
+type SRVResolver struct {
+	Service, Proto, Name string
+	// Resolver is net.DefaultResolver if nil
+	Resolver *stdnet.Resolver
+}
+
+func (s *SRVResolver) Resolve() ([]string, error) {
+	r := s.Resolver
+	if r == nil {
+		r = stdnet.DefaultResolver
+	}
+	ctx, cancel := lookupContext()
+	defer cancel()
+	_, srvs, err := r.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(srvs))
+	for i, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs[i] = stdnet.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+	}
+	return addrs, nil
+}
+
+// HostResolver resolves addresses from DNS A/AAAA records of Host, adding Port to every address
+type HostResolver struct {
+	Host string
+	Port int
+	// Resolver is net.DefaultResolver if nil
+	Resolver *stdnet.Resolver
+}
+
+func (h *HostResolver) Resolve() ([]string, error) {
+	r := h.Resolver
+	if r == nil {
+		r = stdnet.DefaultResolver
+	}
+	ctx, cancel := lookupContext()
+	defer cancel()
+	ips, err := r.LookupHost(ctx, h.Host)
+	if err != nil {
+		return nil, err
+	}
+	port := strconv.Itoa(h.Port)
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = stdnet.JoinHostPort(ip, port)
+	}
+	return addrs, nil
+}
+
+// FileResolver reads addresses from file, one per line. Empty lines and lines starting with # are skipped.
+// It is not a Watcher: changes are noticed when Cluster polls it on its Interval, and file is
+// reread only when its modification time or size changes.
+type FileResolver struct {
+	Path string
+
+	m     sync.Mutex
+	mtime time.Time
+	size  int64
+	addrs []string
+}
+
+func (f *FileResolver) Resolve() ([]string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	st, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	if f.addrs == nil || !st.ModTime().Equal(f.mtime) || st.Size() != f.size {
+		data, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.addrs = parseAddrs(data)
+		f.mtime = st.ModTime()
+		f.size = st.Size()
+	}
+	return append([]string(nil), f.addrs...), nil
+}
+
+func parseAddrs(data []byte) []string {
+	addrs := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	return addrs
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"log"
+	"sync"
 	"time"
 
 	"github.com/funny-falcon/go-iproto"
@@ -35,6 +36,7 @@ type Server struct {
 
 	iproto.SimplePoint
 
+	m           sync.Mutex
 	connections map[uint64]*connection.Connection
 	curId       uint64
 	needConns   int
@@ -72,6 +74,9 @@ func (cfg ServerConfig) NewServer() (serv *Server) {
 				ReadTimeout:  cfg.ReadTimeout,
 				WriteTimeout: cfg.WriteTimeout,
 				RetCodeType:  cfg.RetCodeType,
+				MaxBodySize:  cfg.MaxBodySize,
+				TLS:          cfg.TLS,
+				Dialer:       cfg.Dialer,
 			},
 		},
 		connErr:     make(chan connection.Error, 4),
@@ -90,7 +95,9 @@ func (serv *Server) fixConnections() {
 	for ; needConn > 0; needConn-- {
 		serv.curId++
 		conn := connection.NewConnection(&serv.CConf, serv.curId)
+		serv.m.Lock()
 		serv.connections[serv.curId] = conn
+		serv.m.Unlock()
 		serv.RunChild(conn)
 		serv.dialing++
 	}
@@ -166,7 +173,9 @@ func (serv *Server) onConnError(connErr connection.Error) {
 			if _, ok := serv.connections[conn.Id]; !ok {
 				log.Panicf("Unknown connection failed %+v", conn)
 			}
+			serv.m.Lock()
 			delete(serv.connections, conn.Id)
+			serv.m.Unlock()
 			if serv.established == 0 && serv.Standalone() {
 				serv.AllDisconnected()
 			}
@@ -184,10 +193,22 @@ func (serv *Server) onConnError(connErr connection.Error) {
 		if _, ok := serv.connections[conn.Id]; !ok {
 			log.Panicf("Unknown connection failed %+v", conn)
 		}
+		serv.m.Lock()
 		delete(serv.connections, conn.Id)
+		serv.m.Unlock()
 	}
 }
 
+// InFly returns number of requests sent to server and not yet answered, summed over connections
+func (serv *Server) InFly() (n int) {
+	serv.m.Lock()
+	defer serv.m.Unlock()
+	for _, conn := range serv.connections {
+		n += conn.InFly()
+	}
+	return
+}
+
 func (serv *Server) SetConnections(n int) {
 	serv.actions <- action{kind: setServ, servs: n}
 }
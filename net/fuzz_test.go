@@ -0,0 +1,74 @@
+//go:build go1.18
+
+package net
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+const fuzzMaxBody = 1 << 16
+
+func fuzzSeeds(f *testing.F) {
+	var b bytes.Buffer
+	var w HeaderWriter
+	w.Init(&b, 0, RC4byte)
+	w.WriteRequest(Request{Msg: 17, Id: 1, Body: []byte{1, 2, 3, 4}})
+	w.Ping()
+	w.WriteResponse(Response{Msg: 17, Id: 1, Code: iproto.RcOK, Body: []byte{1, 2, 3}})
+	w.Flush()
+	f.Add(b.Bytes())
+	/* header announcing 4GB body */
+	f.Add([]byte{17, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 1, 0, 0, 0})
+	/* body shorter than return code */
+	f.Add([]byte{17, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0})
+}
+
+func checkBodySize(t *testing.T, body []byte, err error) {
+	var bse *BodySizeError
+	if errors.As(err, &bse) && int(bse.Size) <= bse.Max {
+		t.Fatalf("body of %d bytes is rejected with max %d", bse.Size, bse.Max)
+	}
+	if len(body) > fuzzMaxBody {
+		t.Fatalf("body of %d bytes is read with max %d", len(body), fuzzMaxBody)
+	}
+}
+
+/* header parsing should fail with error on malformed stream, and never allocate more than MaxBodySize */
+func FuzzReadRequest(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var h HeaderReader
+		h.Init(bytes.NewReader(b), time.Second, RC4byte)
+		h.MaxBodySize = fuzzMaxBody
+		for {
+			req, err := h.ReadRequest()
+			checkBodySize(t, req.Body, err)
+			if err != nil {
+				break
+			}
+		}
+	})
+}
+
+func FuzzReadResponse(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, rc := range []RCType{RC4byte, RC1byte, RC0byte} {
+			var h HeaderReader
+			h.Init(bytes.NewReader(b), time.Second, rc)
+			h.MaxBodySize = fuzzMaxBody
+			for {
+				res, err := h.ReadResponse()
+				checkBodySize(t, res.Body, err)
+				if err != nil {
+					break
+				}
+			}
+		}
+	})
+}
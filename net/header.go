@@ -3,6 +3,7 @@ package net
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -19,9 +20,36 @@ type Request struct {
 
 type Response iproto.Response
 
+// DefaultMaxBodySize is used by HeaderReader with zero MaxBodySize
+var DefaultMaxBodySize = 64 * 1024 * 1024
+
+// BodySizeError is returned by HeaderReader when header announces body longer than MaxBodySize.
+// Body is not read, so connection could not be used after it.
+type BodySizeError struct {
+	Msg  iproto.RequestType
+	Size uint32
+	Max  int
+}
+
+func (e *BodySizeError) Error() string {
+	return fmt.Sprintf("Iproto protocol error: body of message %d has %d bytes, max is %d", e.Msg, e.Size, e.Max)
+}
+
+// RCTypeError is returned by HeaderReader and HeaderWriter initialized with unknown RCType.
+type RCTypeError struct {
+	RC RCType
+}
+
+func (e *RCTypeError) Error() string {
+	return fmt.Sprintf("Unsupported return code len %d", e.RC)
+}
+
 type HeaderReader struct {
 	r  SliceReader
 	rc RCType
+	// MaxBodySize limits body length read from header, DefaultMaxBodySize is used if it is zero,
+	// negative value disables the limit
+	MaxBodySize int
 }
 
 func (h *HeaderReader) Init(conn io.Reader, timeout time.Duration, rc RCType) {
@@ -36,6 +64,9 @@ func (h *HeaderReader) ReadRequest() (req Request, err error) {
 	}
 
 	body_len := bin_le.Uint32(head[4:8])
+	if err = h.checkBodyLen(head, body_len); err != nil {
+		return
+	}
 	if body, err = h.r.Read(int(body_len)); err != nil {
 		return
 	}
@@ -59,6 +90,9 @@ func (h *HeaderReader) ReadResponse() (res Response, err error) {
 
 	msg := iproto.RequestType(bin_le.Uint32(head[:4]))
 	body_len := bin_le.Uint32(head[4:8])
+	if err = h.checkBodyLen(head, body_len); err != nil {
+		return
+	}
 
 	if msg != iproto.Ping {
 		switch h.rc {
@@ -86,6 +120,9 @@ func (h *HeaderReader) ReadResponse() (res Response, err error) {
 				}
 				code = iproto.RetCode(bin_le.Uint32(cd))
 			}
+		default:
+			err = &RCTypeError{RC: h.rc}
+			return
 		}
 	}
 
@@ -103,6 +140,17 @@ func (h *HeaderReader) ReadResponse() (res Response, err error) {
 	return
 }
 
+func (h *HeaderReader) checkBodyLen(head []byte, body_len uint32) error {
+	max := h.MaxBodySize
+	if max == 0 {
+		max = DefaultMaxBodySize
+	}
+	if uint64(body_len) > uint64(max) {
+		return &BodySizeError{Msg: iproto.RequestType(bin_le.Uint32(head[:4])), Size: body_len, Max: max}
+	}
+	return nil
+}
+
 func (h *HeaderReader) ReadPing() (err error) {
 	var head []byte
 	if head, err = h.r.Read(12); err != nil {
@@ -135,7 +183,8 @@ func (h *HeaderWriter) Init(w io.Writer, timeout time.Duration, rc RCType) {
 	case RC4byte:
 		h.rcl = 4
 	default:
-		panic("Unsupported return code len")
+		/* WriteResponse will fail with RCTypeError */
+		h.rcl = -1
 	}
 }
 
@@ -156,16 +205,21 @@ func (h *HeaderWriter) Ping() (err error) {
 }
 
 func (h *HeaderWriter) WriteResponse(res Response) (err error) {
+	rc := h.rc
 	retCodeLen := h.rcl
 	if res.Msg == iproto.Ping {
+		rc = RC0byte
 		retCodeLen = 0
 	}
+	if retCodeLen < 0 {
+		return &RCTypeError{RC: rc}
+	}
 	body_len := uint32(len(res.Body) + retCodeLen)
 	if err = h.w.Write3Uint32(uint32(res.Msg), body_len, uint32(res.Id)); err != nil {
 		return
 	}
 
-	switch h.rc {
+	switch rc {
 	case RC0byte:
 	case RC1byte:
 		if err = h.w.WriteByte(byte(res.Code)); err != nil {
@@ -175,8 +229,6 @@ func (h *HeaderWriter) WriteResponse(res Response) (err error) {
 		if err = h.w.WriteUint32(uint32(res.Code)); err != nil {
 			return
 		}
-	default:
-		panic("Unsupported return code len")
 	}
 
 	err = h.w.Write(res.Body)
@@ -0,0 +1,60 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+/* ping response has no return code whatever RCType is, so peer could read stream further */
+func TestWriteResponsePing(t *testing.T) {
+	for _, rc := range []RCType{RC0byte, RC1byte, RC4byte} {
+		var b bytes.Buffer
+		var w HeaderWriter
+		w.Init(&b, 0, rc)
+		w.WriteResponse(Response{Msg: iproto.Ping, Id: iproto.PingRequestId, Code: iproto.RcOK})
+		w.Flush()
+		if b.Len() != 12 {
+			t.Errorf("rc %d: ping response takes %d bytes", rc, b.Len())
+		}
+		w.WriteResponse(Response{Msg: 17, Id: 1, Code: 2, Body: []byte{1, 2}})
+		w.Flush()
+
+		var h HeaderReader
+		h.Init(&b, time.Second, rc)
+		if res, err := h.ReadResponse(); err != nil || res.Msg != iproto.Ping || len(res.Body) != 0 {
+			t.Errorf("rc %d: ping response %+v, %v", rc, res, err)
+		}
+		res, err := h.ReadResponse()
+		code := iproto.RetCode(2)
+		if rc == RC0byte {
+			code = iproto.RcOK
+		}
+		if err != nil || res.Msg != 17 || res.Code != code || !bytes.Equal(res.Body, []byte{1, 2}) {
+			t.Errorf("rc %d: response after ping %+v, %v", rc, res, err)
+		}
+	}
+}
+
+func TestRCTypeError(t *testing.T) {
+	var b bytes.Buffer
+	var w HeaderWriter
+	w.Init(&b, 0, RCType(17))
+	var rce *RCTypeError
+	if err := w.WriteResponse(Response{Msg: 17, Id: 1}); !errors.As(err, &rce) || rce.RC != 17 {
+		t.Errorf("unknown rc type written with %v", err)
+	}
+	if err := w.WriteResponse(Response{Msg: iproto.Ping, Id: iproto.PingRequestId}); err != nil {
+		t.Errorf("ping response is not written: %v", err)
+	}
+	w.Flush()
+
+	var h HeaderReader
+	h.Init(bytes.NewReader([]byte{17, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}), time.Second, RCType(17))
+	if _, err := h.ReadResponse(); !errors.As(err, &rce) {
+		t.Errorf("unknown rc type read with %v", err)
+	}
+}
@@ -0,0 +1,476 @@
+// Package memnet is an in-memory transport for testing clients and servers without sockets.
+//
+// Connections support half-close, deadlines and fault injection. Listen and Dialer.Dial match
+// server.Config.Listen and client.Dialer, so both sides could be wired together:
+//
+//	serv := (&server.Config{Network: "mem", Address: "box", Listen: memnet.Listen, ...}).NewServer()
+//	cl := client.ServerConfig{Network: "mem", Address: "box", Dialer: &memnet.Dialer{}}.NewServer()
+package memnet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReset        = errors.New("memnet: connection reset by peer")
+	ErrRefused      = errors.New("memnet: connection refused")
+	ErrAddressInUse = errors.New("memnet: address already in use")
+)
+
+// Addr is an address of in-memory listener
+type Addr string
+
+func (a Addr) Network() string { return "mem" }
+func (a Addr) String() string  { return string(a) }
+
+// Faults describes misbehaviour of written data
+type Faults struct {
+	// Delay postpones delivery of every write
+	Delay time.Duration
+	// Chunk limits number of bytes returned by one Read of peer, so messages arrive in parts
+	Chunk int
+	// DropWrites silently discards written data
+	DropWrites bool
+	// ResetAfter resets connection after this number of bytes written, last write is partial
+	ResetAfter int
+}
+
+type segment struct {
+	b  []byte
+	at time.Time
+}
+
+// pipe is one direction of connection
+type pipe struct {
+	m        sync.Mutex
+	c        sync.Cond
+	segs     []segment
+	wclosed  bool
+	rclosed  bool
+	reset    bool
+	deadline time.Time
+	timer    *time.Timer
+	chunk    int
+}
+
+func newPipe(chunk int) *pipe {
+	p := &pipe{chunk: chunk}
+	p.c.L = &p.m
+	return p
+}
+
+func (p *pipe) wakeAt(t time.Time) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(time.Until(t), func() {
+		p.m.Lock()
+		p.c.Broadcast()
+		p.m.Unlock()
+	})
+}
+
+func (p *pipe) read(b []byte) (n int, err error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for {
+		now := time.Now()
+		switch {
+		case p.reset && len(p.segs) == 0:
+			return 0, ErrReset
+		case p.rclosed:
+			return 0, io.EOF
+		case !p.deadline.IsZero() && !now.Before(p.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		if len(p.segs) > 0 && !p.segs[0].at.After(now) {
+			break
+		}
+		if len(p.segs) == 0 && p.wclosed {
+			return 0, io.EOF
+		}
+		wake := p.deadline
+		if len(p.segs) > 0 && (wake.IsZero() || p.segs[0].at.Before(wake)) {
+			wake = p.segs[0].at
+		}
+		if !wake.IsZero() {
+			p.wakeAt(wake)
+		}
+		p.c.Wait()
+	}
+	if p.chunk > 0 && len(b) > p.chunk {
+		b = b[:p.chunk]
+	}
+	for len(b) > n && len(p.segs) > 0 && !p.segs[0].at.After(time.Now()) {
+		seg := &p.segs[0]
+		k := copy(b[n:], seg.b)
+		n += k
+		if seg.b = seg.b[k:]; len(seg.b) == 0 {
+			p.segs = p.segs[1:]
+		}
+	}
+	return n, nil
+}
+
+func (p *pipe) write(b []byte, delay time.Duration) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	switch {
+	case p.reset:
+		return ErrReset
+	case p.wclosed:
+		return net.ErrClosed
+	}
+	if !p.rclosed && len(b) > 0 {
+		buf := make([]byte, len(b))
+		copy(buf, b)
+		p.segs = append(p.segs, segment{b: buf, at: time.Now().Add(delay)})
+		p.c.Broadcast()
+	}
+	return nil
+}
+
+func (p *pipe) closeWrite() {
+	p.m.Lock()
+	p.wclosed = true
+	p.c.Broadcast()
+	p.m.Unlock()
+}
+
+func (p *pipe) closeRead() {
+	p.m.Lock()
+	p.rclosed = true
+	p.segs = nil
+	p.c.Broadcast()
+	p.m.Unlock()
+}
+
+func (p *pipe) doReset() {
+	p.m.Lock()
+	p.reset = true
+	p.c.Broadcast()
+	p.m.Unlock()
+}
+
+func (p *pipe) setDeadline(t time.Time) {
+	p.m.Lock()
+	p.deadline = t
+	p.c.Broadcast()
+	p.m.Unlock()
+}
+
+// Conn is one side of in-memory connection. It implements net.Conn and nt.NetConn
+type Conn struct {
+	r, w          *pipe
+	local, remote Addr
+	faults        Faults
+
+	m         sync.Mutex
+	written   int
+	closed    bool
+	rclosed   bool
+	wclosed   bool
+	wDeadline time.Time
+	// forget removes connection from Conns of its listener or dialer
+	forget func()
+}
+
+func newConnPair(client, server Addr, cf, sf Faults) (*Conn, *Conn) {
+	cs, sc := newPipe(cf.Chunk), newPipe(sf.Chunk)
+	c := &Conn{r: sc, w: cs, local: client, remote: server, faults: cf}
+	s := &Conn{r: cs, w: sc, local: server, remote: client, faults: sf}
+	return c, s
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	return c.r.read(b)
+}
+
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return 0, net.ErrClosed
+	}
+	if !c.wDeadline.IsZero() && !time.Now().Before(c.wDeadline) {
+		c.m.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	f := c.faults
+	reset := false
+	n = len(b)
+	if f.ResetAfter > 0 && c.written+n >= f.ResetAfter {
+		n = f.ResetAfter - c.written
+		reset = true
+	}
+	c.written += n
+	c.m.Unlock()
+
+	if !f.DropWrites {
+		if err = c.w.write(b[:n], f.Delay); err != nil {
+			return 0, err
+		}
+	}
+	if reset {
+		c.Reset()
+		return n, ErrReset
+	}
+	return n, nil
+}
+
+// SetFaults changes faults of data written by this side
+func (c *Conn) SetFaults(f Faults) {
+	c.m.Lock()
+	c.faults = f
+	c.m.Unlock()
+	c.w.m.Lock()
+	c.w.chunk = f.Chunk
+	c.w.m.Unlock()
+}
+
+// Reset breaks connection in both directions: writes fail with ErrReset, and reads fail
+// with ErrReset after already delivered data is read
+func (c *Conn) Reset() {
+	c.r.doReset()
+	c.w.doReset()
+}
+
+func (c *Conn) CloseRead() error {
+	c.r.closeRead()
+	c.m.Lock()
+	c.rclosed = true
+	c.m.Unlock()
+	c.released()
+	return nil
+}
+
+func (c *Conn) CloseWrite() error {
+	c.w.closeWrite()
+	c.m.Lock()
+	c.wclosed = true
+	c.m.Unlock()
+	c.released()
+	return nil
+}
+
+func (c *Conn) Close() error {
+	c.m.Lock()
+	if c.closed {
+		c.m.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.m.Unlock()
+	c.r.closeRead()
+	c.w.closeWrite()
+	c.released()
+	return nil
+}
+
+/* released forgets connection once it is closed or both its sides are closed */
+func (c *Conn) released() {
+	c.m.Lock()
+	var forget func()
+	if c.closed || c.rclosed && c.wclosed {
+		forget, c.forget = c.forget, nil
+	}
+	c.m.Unlock()
+	if forget != nil {
+		forget()
+	}
+}
+
+func removeConn(all []*Conn, c *Conn) []*Conn {
+	for i, o := range all {
+		if o == c {
+			copy(all[i:], all[i+1:])
+			all[len(all)-1] = nil
+			return all[:len(all)-1]
+		}
+	}
+	return all
+}
+
+func (c *Conn) isClosed() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.closed
+}
+
+func (c *Conn) LocalAddr() net.Addr  { return c.local }
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline is checked on Write only: writes never block
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.m.Lock()
+	c.wDeadline = t
+	c.m.Unlock()
+	return nil
+}
+
+var (
+	registryM sync.Mutex
+	registry  = make(map[string]*Listener)
+)
+
+// Listener accepts in-memory connections dialed to its address
+type Listener struct {
+	// Faults are applied to data written by accepted connections
+	Faults Faults
+
+	addr   Addr
+	conns  chan *Conn
+	done   chan struct{}
+	once   sync.Once
+	m      sync.Mutex
+	client int
+	all    []*Conn
+}
+
+// Listen registers listener with address. network is ignored, so it could be used as server.Config.Listen
+func Listen(network, address string) (net.Listener, error) {
+	l, err := NewListener(address)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func NewListener(address string) (*Listener, error) {
+	registryM.Lock()
+	defer registryM.Unlock()
+	if _, ok := registry[address]; ok {
+		return nil, &net.OpError{Op: "listen", Net: "mem", Addr: Addr(address), Err: ErrAddressInUse}
+	}
+	l := &Listener{
+		addr:  Addr(address),
+		conns: make(chan *Conn, 16),
+		done:  make(chan struct{}),
+	}
+	registry[address] = l
+	return l, nil
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, &net.OpError{Op: "accept", Net: "mem", Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		registryM.Lock()
+		delete(registry, string(l.addr))
+		registryM.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Conns returns connections accepted by listener and not yet closed
+func (l *Listener) Conns() []*Conn {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return append([]*Conn(nil), l.all...)
+}
+
+func (l *Listener) connect(cf Faults) (*Conn, error) {
+	l.m.Lock()
+	l.client++
+	clientAddr := Addr(string(l.addr) + "-client-" + strconv.Itoa(l.client))
+	sf := l.Faults
+	l.m.Unlock()
+
+	c, s := newConnPair(clientAddr, l.addr, cf, sf)
+	s.forget = func() {
+		l.m.Lock()
+		l.all = removeConn(l.all, s)
+		l.m.Unlock()
+	}
+	l.m.Lock()
+	l.all = append(l.all, s)
+	l.m.Unlock()
+	select {
+	case l.conns <- s:
+	case <-l.done:
+		s.forget()
+		return nil, ErrRefused
+	}
+	return c, nil
+}
+
+// Dialer connects to Listener registered with Listen. It implements client.Dialer
+type Dialer struct {
+	// Faults are applied to data written by dialed connections
+	Faults Faults
+	// Refuse makes dialer fail, to simulate unreachable server
+	Refuse bool
+
+	m   sync.Mutex
+	all []*Conn
+}
+
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	d.m.Lock()
+	refuse, faults := d.Refuse, d.Faults
+	d.m.Unlock()
+	registryM.Lock()
+	l := registry[address]
+	registryM.Unlock()
+	if l == nil || refuse {
+		return nil, &net.OpError{Op: "dial", Net: "mem", Addr: Addr(address), Err: ErrRefused}
+	}
+	c, err := l.connect(faults)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "mem", Addr: Addr(address), Err: err}
+	}
+	c.forget = func() {
+		d.m.Lock()
+		d.all = removeConn(d.all, c)
+		d.m.Unlock()
+	}
+	d.m.Lock()
+	d.all = append(d.all, c)
+	d.m.Unlock()
+	return c, nil
+}
+
+// SetRefuse switches refusing of new connections
+func (d *Dialer) SetRefuse(refuse bool) {
+	d.m.Lock()
+	d.Refuse = refuse
+	d.m.Unlock()
+}
+
+// Conns returns connections established by dialer and not yet closed
+func (d *Dialer) Conns() []*Conn {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return append([]*Conn(nil), d.all...)
+}
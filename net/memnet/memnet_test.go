@@ -0,0 +1,246 @@
+package memnet
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+	"github.com/funny-falcon/go-iproto/net/server"
+)
+
+func pair(t *testing.T, name string, cf, sf Faults) (*Conn, *Conn, *Listener) {
+	l, err := NewListener(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Faults = sf
+	d := &Dialer{Faults: cf}
+	c, err := d.Dial("mem", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*Conn), s.(*Conn), l
+}
+
+func TestHalfClose(t *testing.T) {
+	c, s, l := pair(t, "halfclose", Faults{}, Faults{})
+	defer l.Close()
+
+	c.Write([]byte("abc"))
+	c.CloseWrite()
+	b, err := ioutil.ReadAll(s)
+	if err != nil || string(b) != "abc" {
+		t.Fatalf("read %q %v", b, err)
+	}
+	if _, err = s.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if b, err = ioutil.ReadAll(c); err != nil || string(b) != "x" {
+		t.Fatalf("read %q %v", b, err)
+	}
+	if _, err = c.Write([]byte("y")); err == nil {
+		t.Errorf("write after CloseWrite should fail")
+	}
+}
+
+func TestCloseReadAndDeadline(t *testing.T) {
+	c, s, l := pair(t, "deadline", Faults{}, Faults{})
+	defer l.Close()
+
+	s.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := s.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	s.SetReadDeadline(time.Time{})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.CloseRead()
+	}()
+	if _, err = s.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF after CloseRead, got %v", err)
+	}
+	if _, err = c.Write([]byte("a")); err != nil {
+		t.Fatalf("write to read-closed peer should not fail, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	c, s, l := pair(t, "faults", Faults{Delay: 30 * time.Millisecond, Chunk: 2}, Faults{ResetAfter: 3})
+	defer l.Close()
+
+	st := time.Now()
+	c.Write([]byte("abcde"))
+	b := make([]byte, 10)
+	n, err := s.Read(b)
+	if err != nil || string(b[:n]) != "ab" {
+		t.Fatalf("read %q %v", b[:n], err)
+	}
+	if time.Since(st) < 30*time.Millisecond {
+		t.Errorf("write should be delayed")
+	}
+
+	n, err = s.Write([]byte("12345"))
+	if n != 3 || err != ErrReset {
+		t.Fatalf("expected partial write and reset, got %d %v", n, err)
+	}
+	if n, err = io.ReadFull(c, b[:3]); err != nil || string(b[:n]) != "123" {
+		t.Fatalf("partial data should be delivered, got %q %v", b[:n], err)
+	}
+	if _, err = c.Read(b); err != ErrReset {
+		t.Fatalf("expected reset, got %v", err)
+	}
+
+	c2, s2, l2 := pair(t, "drop", Faults{DropWrites: true}, Faults{})
+	defer l2.Close()
+	c2.Write([]byte("lost"))
+	c2.Close()
+	if b, err := ioutil.ReadAll(s2); err != nil || len(b) != 0 {
+		t.Errorf("dropped writes were delivered: %q %v", b, err)
+	}
+}
+
+func TestListenDial(t *testing.T) {
+	l, err := Listen("mem", "listendial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l2, err := Listen("mem", "listendial"); err == nil {
+		l2.Close()
+		t.Errorf("second listen on same address should fail")
+	}
+	if _, err := (&Dialer{}).Dial("mem", "listendial-nowhere"); err == nil {
+		t.Errorf("dial to unknown address should fail")
+	}
+}
+
+func TestConnsForgotten(t *testing.T) {
+	l, err := NewListener("forgotten")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	d := &Dialer{}
+	c, err := d.Dial("mem", "forgotten")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Conns()) != 1 || len(l.Conns()) != 1 {
+		t.Fatalf("connections are not registered: %d %d", len(d.Conns()), len(l.Conns()))
+	}
+
+	c.Close()
+	if len(d.Conns()) != 0 {
+		t.Errorf("closed connection is still held by dialer")
+	}
+	/* half-closing both sides is same as close */
+	s.(*Conn).CloseRead()
+	if len(l.Conns()) != 1 {
+		t.Errorf("half-closed connection is forgotten")
+	}
+	s.(*Conn).CloseWrite()
+	if len(l.Conns()) != 0 {
+		t.Errorf("closed connection is still held by listener")
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	held := make(chan *iproto.Request, 1)
+	ep := iproto.SF(func(r *iproto.Request) {
+		if r.Msg == 2 {
+			held <- r
+			return
+		}
+		r.Respond(iproto.RcOK, r.Body)
+	})
+	serv := (&server.Config{Network: "mem", Address: "box", EndPoint: ep, Listen: Listen}).NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer serv.Shutdown(time.Second)
+
+	d := &Dialer{Faults: Faults{Chunk: 3}}
+	cl := client.ServerConfig{Network: "mem", Address: "box", Timeout: time.Second, Dialer: d}.NewServer()
+	iproto.Run(cl)
+	defer cl.Stop()
+
+	if res := iproto.CallMsgBody(cl, 1, iproto.Body("hello")); res.Code != iproto.RcOK || string(res.Body) != "hello" {
+		t.Fatalf("unexpected response %x %q", res.Code, res.Body)
+	}
+
+	_, res := iproto.SendMsgBody(cl, 2, iproto.Body("hold"))
+	<-held
+	reset := d.Conns()[0]
+	reset.Reset()
+	if r := <-res; r.Code != iproto.RcIOError {
+		t.Fatalf("request in fly should fail with IOError on reset, got %x", r.Code)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res := iproto.CallMsgBody(cl, 1, iproto.Body("again"))
+		if res.Code == iproto.RcOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client did not reconnect, last code %x", res.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conns := d.Conns(); len(conns) == 0 || conns[len(conns)-1] == reset {
+		t.Errorf("client should redial after reset")
+	}
+}
+
+/* when server closes its write side, client's writeLoop should stop, so requests in fly fail at once */
+func TestClientPeerCloseWrite(t *testing.T) {
+	l, err := NewListener("closewrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	d := &Dialer{}
+	cl := client.ServerConfig{Network: "mem", Address: "closewrite", Timeout: 5 * time.Second, Dialer: d}.NewServer()
+	iproto.Run(cl)
+	defer cl.Stop()
+
+	_, res := iproto.SendMsgBody(cl, 2, iproto.Body("hold"))
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* answer ping with its own header, then wait for request */
+	ping := make([]byte, 12)
+	if _, err = io.ReadFull(s, ping); err != nil {
+		t.Fatal(err)
+	}
+	s.Write(ping)
+	if _, err = io.ReadFull(s, make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	s.(*Conn).CloseWrite()
+	select {
+	case r := <-res:
+		if r.Code != iproto.RcIOError {
+			t.Errorf("request in fly answered with %x", r.Code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("request in fly is not answered after peer closed write side")
+	}
+}
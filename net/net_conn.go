@@ -3,6 +3,7 @@ package net
 import (
 	"io"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -50,3 +51,67 @@ type SetDeadliner interface {
 	SetReadDeadline(t time.Time) error
 	SetWriteDeadline(t time.Time) error
 }
+
+// WrapConn returns conn itself if it supports half-close, otherwise wraps it.
+// Wrapper's CloseRead interrupts pending reads with past read deadline,
+// later reads return io.EOF and later read deadlines are ignored,
+// and connection is closed when both CloseRead and CloseWrite were called.
+func WrapConn(conn net.Conn) NetConn {
+	if nc, ok := conn.(NetConn); ok {
+		return nc
+	}
+	return &connWrapper{Conn: conn}
+}
+
+type connWrapper struct {
+	net.Conn
+	m                   sync.Mutex
+	readClosed, wClosed bool
+}
+
+func (c *connWrapper) Read(b []byte) (int, error) {
+	c.m.Lock()
+	closed := c.readClosed
+	c.m.Unlock()
+	if closed {
+		return 0, io.EOF
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *connWrapper) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.readClosed {
+		/* keep past deadline set by CloseRead */
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *connWrapper) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *connWrapper) CloseRead() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.readClosed = true
+	if c.wClosed {
+		return c.Conn.Close()
+	}
+	return c.Conn.SetReadDeadline(time.Unix(1, 0))
+}
+
+func (c *connWrapper) CloseWrite() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.wClosed = true
+	if c.readClosed {
+		return c.Conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnWrapperCloseReadWithTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c := WrapConn(a)
+	sl := SliceReader{r: c, size: 16, timeout: 5 * time.Second}
+
+	go b.Write([]byte("ab"))
+	if res, err := sl.Read(2); err != nil || string(res) != "ab" {
+		t.Fatalf("read %q, %v", res, err)
+	}
+
+	/* pending read is interrupted although SliceReader set its own deadline */
+	done := make(chan error, 1)
+	go func() {
+		_, err := sl.Read(2)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.CloseRead()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("read should fail after CloseRead")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending read is not interrupted by CloseRead")
+	}
+
+	/* following read fails immediately instead of waiting for timeout */
+	st := time.Now()
+	if _, err := sl.Read(2); err == nil {
+		t.Errorf("read should fail after CloseRead")
+	}
+	if time.Since(st) > time.Second {
+		t.Errorf("read after CloseRead waited for timeout")
+	}
+	c.CloseWrite()
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"crypto/tls"
+	stdnet "net"
 	"time"
 
 	"github.com/funny-falcon/go-iproto"
@@ -18,4 +20,31 @@ type Config struct {
 
 	RCType net.RCType
 	RCMap  map[iproto.RetCode]iproto.RetCode
+
+	// MaxBodySize limits body length of request, connection sending longer one is closed.
+	// net.DefaultMaxBodySize is used if it is zero.
+	MaxBodySize int
+
+	// MaxInFlyPerConn and MaxInFly limit number of requests in fly per connection and per server.
+	// When limit is reached, reading from connection pauses until some request is answered.
+	MaxInFlyPerConn int
+	MaxInFly        int
+	// OverloadCode, if set, makes server answer with it immediately instead of pausing reading
+	OverloadCode iproto.RetCode
+
+	// MaxConns and MaxConnsPerIP limit number of accepted connections in total and per remote host.
+	MaxConns      int
+	MaxConnsPerIP int
+	// AcceptRate limits rate of accepted connections per second, with bursts up to AcceptBurst
+	AcceptRate  float64
+	AcceptBurst int
+	// Admit is called for every connection which passed limits. Connection is closed if it returns false.
+	Admit func(stdnet.Conn) bool
+
+	// TLS enables TLS. Set TLS.ClientAuth and TLS.ClientCAs for mutual TLS,
+	// peer certificates are available through ConnOf(request).PeerCertificates()
+	TLS *tls.Config
+
+	// Listen creates listener in Run, net.Listen is used by default
+	Listen func(network, address string) (stdnet.Listener, error)
 }
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"crypto/x509"
 	"log"
+	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/funny-falcon/go-iproto"
 	nt "github.com/funny-falcon/go-iproto/net"
@@ -31,6 +34,7 @@ type Connection struct {
 	*Server
 	Id   uint64
 	conn nt.NetConn
+	host string
 
 	buf        []nt.Response
 	out        chan nt.Response
@@ -40,6 +44,7 @@ type Connection struct {
 
 	inFly map[uint32]*iproto.Request
 	sync.Mutex
+	sema chan struct{}
 
 	loopNotify chan notifyAction
 }
@@ -58,6 +63,9 @@ func NewConnection(serv *Server, connection nt.NetConn, id uint64) (conn *Connec
 
 		loopNotify: make(chan notifyAction, 2),
 	}
+	if serv.MaxInFlyPerConn > 0 {
+		conn.sema = make(chan struct{}, serv.MaxInFlyPerConn)
+	}
 	return
 }
 
@@ -71,21 +79,102 @@ func (conn *Connection) Stop() {
 	conn.conn.CloseRead()
 }
 
-func (conn *Connection) Respond(r *iproto.Response) {
-	if r.Code&iproto.RcKindMask == iproto.RcInternal {
+// Close closes connection immediately, requests in fly are canceled
+func (conn *Connection) Close() {
+	conn.conn.Close()
+}
+
+// ConnOf returns connection which request were read from, or nil if request came not from server
+// or were already answered
+func ConnOf(r *iproto.Request) *Connection {
+	conn, _ := r.Responder.(*Connection)
+	return conn
+}
+
+func (conn *Connection) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+// PeerCertificates returns certificates presented by client over TLS
+func (conn *Connection) PeerCertificates() []*x509.Certificate {
+	if tc, ok := conn.conn.(*nt.TLSConn); ok {
+		return tc.ConnectionState().PeerCertificates
+	}
+	return nil
+}
+
+// InFly returns number of requests read from connection and not yet responded
+func (conn *Connection) InFly() int {
+	conn.Lock()
+	defer conn.Unlock()
+	return len(conn.inFly)
+}
+
+func (conn *Connection) mapCode(code iproto.RetCode) iproto.RetCode {
+	if code&iproto.RcKindMask == iproto.RcInternal {
 		if conn.RCMap != nil {
-			if repl := conn.RCMap[r.Code]; repl != 0 {
-				r.Code = repl
-				goto CodeEnd
+			if repl := conn.RCMap[code]; repl != 0 {
+				return repl
+			}
+		}
+		code = (code &^ iproto.RcKindMask) | iproto.RcFatal
+	}
+	return code
+}
+
+// acquire takes slots for a request from connection and server limits.
+// It blocks until slots are free, or returns false if OverloadCode is set and limit is reached.
+func (conn *Connection) acquire() bool {
+	overload := conn.OverloadCode != 0
+	if conn.sema != nil {
+		if overload {
+			select {
+			case conn.sema <- struct{}{}:
+			default:
+				return false
+			}
+		} else {
+			conn.sema <- struct{}{}
+		}
+	}
+	if sema := conn.Server.sema; sema != nil {
+		if overload {
+			select {
+			case sema <- struct{}{}:
+			default:
+				if conn.sema != nil {
+					<-conn.sema
+				}
+				return false
 			}
+		} else {
+			sema <- struct{}{}
 		}
-		r.Code = (r.Code &^ iproto.RcKindMask) | iproto.RcFatal
 	}
-CodeEnd:
+	return true
+}
+
+func (conn *Connection) release() {
+	if conn.sema != nil {
+		<-conn.sema
+	}
+	if sema := conn.Server.sema; sema != nil {
+		<-sema
+	}
+}
+
+func (conn *Connection) Respond(r *iproto.Response) {
+	counter := &conn.Server.served
+	if r.Code == iproto.RcCanceled {
+		counter = &conn.Server.canceled
+	}
+	r.Code = conn.mapCode(r.Code)
 
 	conn.Lock()
 	if _, ok := conn.inFly[r.Id]; ok {
 		delete(conn.inFly, r.Id)
+		atomic.AddUint64(counter, 1)
+		conn.release()
 
 		if len(conn.buf) == 0 {
 			select {
@@ -113,12 +202,16 @@ func (conn *Connection) cancelInFly() {
 	for _, req := range reqs {
 		req.Cancel()
 	}
-	conn.Server.connClosed <- conn.Id
 }
 
 func (conn *Connection) closed() {
+	conn.Lock()
+	for range conn.inFly {
+		conn.release()
+	}
 	conn.buf = nil
 	conn.inFly = nil
+	conn.Unlock()
 	conn.Server.connClosed <- conn.Id
 }
 
@@ -161,6 +254,7 @@ func (conn *Connection) readLoop() {
 	var err error
 	var r nt.HeaderReader
 	r.Init(conn.conn, conn.ReadTimeout, conn.RCType)
+	r.MaxBodySize = conn.MaxBodySize
 
 	defer conn.notifyLoop(readClosed)
 
@@ -181,6 +275,15 @@ func (conn *Connection) readLoop() {
 			continue
 		}
 
+		if !conn.acquire() {
+			conn.out <- nt.Response{
+				Id:   req.Id,
+				Msg:  req.Msg,
+				Code: conn.mapCode(conn.OverloadCode),
+			}
+			continue
+		}
+
 		if buf == nil {
 			buf = &[16]iproto.Request{}
 		}
@@ -197,6 +300,10 @@ func (conn *Connection) readLoop() {
 			Responder: conn,
 		}
 		conn.Lock()
+		if _, dup := conn.inFly[request.Id]; dup {
+			/* only one of requests with same id will be answered, so it holds one slot */
+			conn.release()
+		}
 		conn.inFly[request.Id] = request
 		conn.Unlock()
 
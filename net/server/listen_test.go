@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+)
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// pipeListener connects Dial and Accept with net.Pipe, which has no half-close
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+func (l *pipeListener) Dial(network, address string) (net.Conn, error) {
+	c, s := net.Pipe()
+	l.conns <- s
+	return c, nil
+}
+
+func TestDialerAndListen(t *testing.T) {
+	l := &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+	serv := (&Config{
+		Network:  "pipe",
+		Address:  "pipe",
+		EndPoint: testEndPoint,
+		Listen:   func(network, address string) (net.Listener, error) { return l, nil },
+	}).NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	cl := client.ServerConfig{Network: "pipe", Address: "pipe", Timeout: time.Second, Dialer: l}.NewServer()
+	iproto.Run(cl)
+	res := iproto.CallMsgBody(cl, msgFast, iproto.Body("ping"))
+	if res.Code != iproto.RcOK || string(res.Body) != "ping" {
+		t.Errorf("unexpected response %x %q", res.Code, res.Body)
+	}
+
+	cl.Stop()
+	serv.Shutdown(time.Second)
+	if serv.Connections() != 0 {
+		t.Errorf("connections should be closed")
+	}
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/funny-falcon/go-iproto"
 	nt "github.com/funny-falcon/go-iproto/net"
@@ -23,6 +26,17 @@ type Server struct {
 	sync.Mutex
 	conns     map[uint64]*Connection
 	currentId uint64
+
+	served   uint64
+	canceled uint64
+
+	sema chan struct{}
+
+	perIP    map[string]int
+	reserved int
+	rejected uint64
+	tokens   float64
+	lastTok  time.Time
 }
 
 func (cfg *Config) NewServer() (serv *Server) {
@@ -44,6 +58,10 @@ func (cfg *Config) NewServer() (serv *Server) {
 	serv.stop = make(chan bool, 1)
 	serv.connClosed = make(chan uint64)
 	serv.conns = make(map[uint64]*Connection)
+	serv.perIP = make(map[string]int)
+	if serv.MaxInFly > 0 {
+		serv.sema = make(chan struct{}, serv.MaxInFly)
+	}
 
 	return
 }
@@ -52,22 +70,113 @@ func (serv *Server) Run() (err error) {
 	if !serv.EndPoint.Runned() {
 		return fmt.Errorf("End point is not running %+v", serv.EndPoint)
 	}
-	if serv.listener, err = net.Listen(serv.Network, serv.Address); err != nil {
+	listen := serv.Listen
+	if listen == nil {
+		listen = net.Listen
+	}
+	var listener net.Listener
+	if listener, err = listen(serv.Network, serv.Address); err != nil {
 		return
 	}
 	log.Println("Binded to", serv.Address)
+	return serv.Serve(listener)
+}
+
+// Serve accepts connections on already created listener (for example, inherited with socket activation)
+func (serv *Server) Serve(listener net.Listener) error {
+	if !serv.EndPoint.Runned() {
+		return fmt.Errorf("End point is not running %+v", serv.EndPoint)
+	}
+	serv.Lock()
+	if serv.closing {
+		serv.Unlock()
+		listener.Close()
+		return fmt.Errorf("Server is stopped")
+	}
+	serv.listener = listener
+	serv.Unlock()
 
 	go serv.listenLoop()
 	go serv.controlLoop()
-	return
+	return nil
 }
 
+// Stop stops accepting connections and reading requests. It is safe to call it several times
+// and before Run.
 func (serv *Server) Stop() {
 	serv.Lock()
+	if serv.closing {
+		serv.Unlock()
+		return
+	}
 	serv.closing = true
-	serv.stop <- true
+	listener := serv.listener
+	if listener != nil {
+		serv.stop <- true
+	}
 	serv.Unlock()
-	serv.listener.Close()
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+// Shutdown stops accepting connections and reading requests, and waits up to timeout
+// for requests in fly to be answered. Requests which are still in fly after timeout are canceled.
+// Shutdown returns when all connections are closed, so WriteTimeout should be set
+// if clients could stop reading responses.
+// It returns number of requests answered and canceled since Shutdown were called.
+func (serv *Server) Shutdown(timeout time.Duration) (completed, canceled int) {
+	served0 := atomic.LoadUint64(&serv.served)
+	canceled0 := atomic.LoadUint64(&serv.canceled)
+	serv.Stop()
+	serv.Lock()
+	served := serv.listener != nil
+	serv.Unlock()
+	if !served {
+		/* controlLoop were never started, so Running will not be closed */
+		return
+	}
+	t := time.NewTimer(timeout)
+	select {
+	case <-serv.Running:
+		t.Stop()
+	case <-t.C:
+		serv.Lock()
+		conns := make([]*Connection, 0, len(serv.conns))
+		for _, conn := range serv.conns {
+			conns = append(conns, conn)
+		}
+		serv.Unlock()
+		for _, conn := range conns {
+			conn.cancelInFly()
+		}
+		<-serv.Running
+	}
+	completed = int(atomic.LoadUint64(&serv.served) - served0)
+	canceled = int(atomic.LoadUint64(&serv.canceled) - canceled0)
+	return
+}
+
+// Addr returns address server listens on, it is useful when server were bound to ephemeral port
+func (serv *Server) Addr() net.Addr {
+	return serv.listener.Addr()
+}
+
+// Connections returns number of accepted and not yet closed connections
+func (serv *Server) Connections() int {
+	serv.Lock()
+	defer serv.Unlock()
+	return len(serv.conns)
+}
+
+// InFly returns number of requests in fly summed over all connections
+func (serv *Server) InFly() (n int) {
+	serv.Lock()
+	defer serv.Unlock()
+	for _, conn := range serv.conns {
+		n += conn.InFly()
+	}
+	return
 }
 
 func (serv *Server) controlLoop() {
@@ -76,6 +185,11 @@ func (serv *Server) controlLoop() {
 		select {
 		case id := <-serv.connClosed:
 			serv.Lock()
+			if conn, ok := serv.conns[id]; ok {
+				if serv.perIP[conn.host]--; serv.perIP[conn.host] <= 0 {
+					delete(serv.perIP, conn.host)
+				}
+			}
 			delete(serv.conns, id)
 			if serv.closing && len(serv.conns) == 0 {
 				serv.Unlock()
@@ -110,17 +224,101 @@ func (serv *Server) listenLoop() {
 			serv.Unlock()
 			continue
 		}
+		host := remoteHost(conn)
+		if !serv.allowAccept() || !serv.reserve(host) {
+			atomic.AddUint64(&serv.rejected, 1)
+			conn.Close()
+			continue
+		}
+		if serv.Admit != nil && !serv.Admit(conn) {
+			serv.Lock()
+			serv.unreserve(host)
+			serv.Unlock()
+			atomic.AddUint64(&serv.rejected, 1)
+			conn.Close()
+			continue
+		}
 		log.Printf("Accepted %s on %s", conn.RemoteAddr(), conn.LocalAddr())
 		serv.Lock()
 		if serv.closing {
+			serv.unreserve(host)
 			serv.Unlock()
 			conn.Close()
 			break
 		}
 		serv.currentId++
-		connection := NewConnection(serv, conn.(nt.NetConn), serv.currentId)
+		var netconn nt.NetConn
+		if serv.TLS != nil {
+			netconn = nt.NewTLSConn(tls.Server(conn, serv.TLS), conn)
+		} else {
+			netconn = nt.WrapConn(conn)
+		}
+		connection := NewConnection(serv, netconn, serv.currentId)
+		connection.host = host
 		serv.conns[serv.currentId] = connection
+		serv.reserved--
 		connection.Run()
 		serv.Unlock()
 	}
 }
+
+// Rejected returns number of connections closed by admission control
+func (serv *Server) Rejected() uint64 {
+	return atomic.LoadUint64(&serv.rejected)
+}
+
+func remoteHost(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// allowAccept is a token bucket for AcceptRate. It is called only from listenLoop.
+func (serv *Server) allowAccept() bool {
+	if serv.AcceptRate <= 0 {
+		return true
+	}
+	burst := float64(serv.AcceptBurst)
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now()
+	if serv.lastTok.IsZero() {
+		serv.tokens = burst
+	} else {
+		serv.tokens += now.Sub(serv.lastTok).Seconds() * serv.AcceptRate
+		if serv.tokens > burst {
+			serv.tokens = burst
+		}
+	}
+	serv.lastTok = now
+	if serv.tokens < 1 {
+		return false
+	}
+	serv.tokens--
+	return true
+}
+
+// reserve checks connection limits and counts connection from host
+func (serv *Server) reserve(host string) bool {
+	serv.Lock()
+	defer serv.Unlock()
+	if serv.MaxConns > 0 && len(serv.conns)+serv.reserved >= serv.MaxConns {
+		return false
+	}
+	if serv.MaxConnsPerIP > 0 && serv.perIP[host] >= serv.MaxConnsPerIP {
+		return false
+	}
+	serv.perIP[host]++
+	serv.reserved++
+	return true
+}
+
+func (serv *Server) unreserve(host string) {
+	serv.reserved--
+	if serv.perIP[host]--; serv.perIP[host] <= 0 {
+		delete(serv.perIP, host)
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	nt "github.com/funny-falcon/go-iproto/net"
+)
+
+const (
+	msgFast = iproto.RequestType(iota + 1)
+	msgSlow
+	msgHang
+)
+
+var testEndPoint = iproto.SF(func(r *iproto.Request) {
+	switch r.Msg {
+	case msgFast:
+		r.Respond(iproto.RcOK, r.Body)
+	case msgSlow:
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			r.Respond(iproto.RcOK, r.Body)
+		}()
+	}
+})
+
+func startServer(t *testing.T, cfg Config) *Server {
+	cfg.Network = "tcp"
+	cfg.Address = "127.0.0.1:0"
+	if cfg.EndPoint == nil {
+		cfg.EndPoint = testEndPoint
+	}
+	serv := cfg.NewServer()
+	if err := serv.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return serv
+}
+
+type testClient struct {
+	conn net.Conn
+	w    nt.HeaderWriter
+	r    nt.HeaderReader
+}
+
+func dial(t *testing.T, serv *Server) *testClient {
+	conn, err := net.Dial("tcp", serv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{conn: conn}
+	c.w.Init(conn, time.Second, nt.RC4byte)
+	c.r.Init(conn, time.Second, nt.RC4byte)
+	return c
+}
+
+func (c *testClient) send(t *testing.T, msg iproto.RequestType, id uint32) {
+	if err := c.w.WriteRequest(nt.Request{Msg: msg, Id: id, Body: []byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitInFly(t *testing.T, serv *Server, n int) {
+	for i := 0; serv.InFly() != n; i++ {
+		if i == 100 {
+			t.Fatalf("expected %d requests in fly, got %d", n, serv.InFly())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	serv := startServer(t, Config{})
+	c := dial(t, serv)
+	defer c.conn.Close()
+
+	c.send(t, msgSlow, 1)
+	c.send(t, msgHang, 2)
+	waitInFly(t, serv, 2)
+
+	completed, canceled := serv.Shutdown(200 * time.Millisecond)
+	if completed != 1 || canceled != 1 {
+		t.Errorf("completed %d canceled %d", completed, canceled)
+	}
+
+	codes := make(map[uint32]iproto.RetCode)
+	for i := 0; i < 2; i++ {
+		res, err := c.r.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes[res.Id] = res.Code
+	}
+	if codes[1] != iproto.RcOK {
+		t.Errorf("slow request answered with %x", codes[1])
+	}
+	if codes[2]&iproto.RcKindMask != iproto.RcFatal {
+		t.Errorf("hung request answered with %x", codes[2])
+	}
+	if _, err := c.r.ReadResponse(); err == nil {
+		t.Errorf("connection should be closed")
+	}
+}
+
+func TestShutdownCompletes(t *testing.T) {
+	serv := startServer(t, Config{})
+	c := dial(t, serv)
+	defer c.conn.Close()
+
+	c.send(t, msgSlow, 1)
+	c.send(t, msgSlow, 2)
+	waitInFly(t, serv, 2)
+
+	st := time.Now()
+	completed, canceled := serv.Shutdown(time.Second)
+	if completed != 2 || canceled != 0 {
+		t.Errorf("completed %d canceled %d", completed, canceled)
+	}
+	if time.Since(st) > 500*time.Millisecond {
+		t.Errorf("shutdown should not wait for timeout")
+	}
+}
+
+func holdingEndPoint(held chan *iproto.Request) iproto.Service {
+	return iproto.SF(func(r *iproto.Request) {
+		held <- r
+	})
+}
+
+func TestMaxInFlyPerConnPausesReading(t *testing.T) {
+	held := make(chan *iproto.Request, 16)
+	serv := startServer(t, Config{EndPoint: holdingEndPoint(held), MaxInFlyPerConn: 2})
+	defer serv.Shutdown(0)
+	c := dial(t, serv)
+	defer c.conn.Close()
+
+	for i := uint32(1); i <= 3; i++ {
+		c.send(t, msgHang, i)
+	}
+	waitInFly(t, serv, 2)
+	time.Sleep(20 * time.Millisecond)
+	if n := serv.InFly(); n != 2 {
+		t.Fatalf("reading should be paused with 2 requests in fly, got %d", n)
+	}
+
+	r := <-held
+	r.Respond(iproto.RcOK, nil)
+	waitInFly(t, serv, 2)
+	for i := 0; i < 2; i++ {
+		r = <-held
+		r.Respond(iproto.RcOK, nil)
+	}
+	for i := 0; i < 3; i++ {
+		res, err := c.r.ReadResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Code != iproto.RcOK {
+			t.Errorf("request %d answered with %x", res.Id, res.Code)
+		}
+	}
+}
+
+func TestMaxInFlyOverloadCode(t *testing.T) {
+	const overload = iproto.RetCode(0x1001)
+	held := make(chan *iproto.Request, 16)
+	serv := startServer(t, Config{EndPoint: holdingEndPoint(held), MaxInFly: 1, OverloadCode: overload})
+	defer serv.Shutdown(0)
+	c1 := dial(t, serv)
+	defer c1.conn.Close()
+	c2 := dial(t, serv)
+	defer c2.conn.Close()
+
+	c1.send(t, msgHang, 1)
+	waitInFly(t, serv, 1)
+	c2.send(t, msgHang, 2)
+	res, err := c2.r.ReadResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Id != 2 || res.Code != overload {
+		t.Fatalf("expected overload answer, got %+v", res)
+	}
+
+	r := <-held
+	r.Respond(iproto.RcOK, nil)
+	if res, err = c1.r.ReadResponse(); err != nil || res.Code != iproto.RcOK {
+		t.Fatalf("expected answer, got %+v %v", res, err)
+	}
+
+	c2.send(t, msgHang, 3)
+	r = <-held
+	r.Respond(iproto.RcOK, nil)
+	if res, err = c2.r.ReadResponse(); err != nil || res.Id != 3 || res.Code != iproto.RcOK {
+		t.Fatalf("slot should be released, got %+v %v", res, err)
+	}
+}
+
+// expectClosed checks whether server closed connection (true) or keeps it open (false)
+func expectClosed(t *testing.T, c *testClient, closed bool) {
+	c.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := c.conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		if closed {
+			t.Errorf("connection should be closed by server")
+		}
+	} else if !closed {
+		t.Errorf("connection should be accepted, got %v", err)
+	}
+}
+
+func waitConns(t *testing.T, serv *Server, n int) {
+	for i := 0; serv.Connections() != n; i++ {
+		if i == 100 {
+			t.Fatalf("expected %d connections, got %d", n, serv.Connections())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	serv := startServer(t, Config{MaxConns: 1})
+	defer serv.Shutdown(0)
+	c1 := dial(t, serv)
+	c2 := dial(t, serv)
+	defer c2.conn.Close()
+	expectClosed(t, c1, false)
+	expectClosed(t, c2, true)
+
+	c1.conn.Close()
+	waitConns(t, serv, 0)
+	c3 := dial(t, serv)
+	defer c3.conn.Close()
+	expectClosed(t, c3, false)
+	if serv.Rejected() != 1 {
+		t.Errorf("expected 1 rejected connection, got %d", serv.Rejected())
+	}
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	serv := startServer(t, Config{MaxConnsPerIP: 2})
+	defer serv.Shutdown(0)
+	var cs []*testClient
+	for i := 0; i < 3; i++ {
+		c := dial(t, serv)
+		defer c.conn.Close()
+		cs = append(cs, c)
+	}
+	expectClosed(t, cs[0], false)
+	expectClosed(t, cs[1], false)
+	expectClosed(t, cs[2], true)
+}
+
+func TestAcceptRate(t *testing.T) {
+	serv := startServer(t, Config{AcceptRate: 1, AcceptBurst: 2})
+	defer serv.Shutdown(0)
+	var cs []*testClient
+	for i := 0; i < 3; i++ {
+		c := dial(t, serv)
+		defer c.conn.Close()
+		cs = append(cs, c)
+	}
+	expectClosed(t, cs[0], false)
+	expectClosed(t, cs[1], false)
+	expectClosed(t, cs[2], true)
+}
+
+func TestAdmit(t *testing.T) {
+	n := 0
+	serv := startServer(t, Config{Admit: func(net.Conn) bool {
+		n++
+		return n%2 == 1
+	}})
+	defer serv.Shutdown(0)
+	c1 := dial(t, serv)
+	defer c1.conn.Close()
+	c2 := dial(t, serv)
+	defer c2.conn.Close()
+	expectClosed(t, c1, false)
+	expectClosed(t, c2, true)
+	waitConns(t, serv, 1)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	serv := startServer(t, Config{MaxBodySize: 16})
+	defer serv.Shutdown(time.Second)
+	c := dial(t, serv)
+	defer c.conn.Close()
+
+	c.send(t, msgFast, 1)
+	if res, err := c.r.ReadResponse(); err != nil || res.Id != 1 {
+		t.Fatalf("small request: %+v %v", res, err)
+	}
+
+	if err := c.w.WriteRequest(nt.Request{Msg: msgFast, Id: 2, Body: make([]byte, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.r.ReadResponse(); err == nil {
+		t.Errorf("connection should be closed, got %+v", res)
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	serv := startServer(t, Config{})
+	serv.Stop()
+	done := make(chan struct{})
+	go func() {
+		serv.Stop()
+		serv.Shutdown(time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("second Stop blocked")
+	}
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	cfg := Config{Network: "tcp", Address: "127.0.0.1:0", EndPoint: testEndPoint}
+	serv := cfg.NewServer()
+	done := make(chan struct{})
+	go func() {
+		serv.Shutdown(time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown before Run blocked")
+	}
+	if err := serv.Run(); err == nil {
+		t.Errorf("Run after Shutdown should fail")
+	}
+}
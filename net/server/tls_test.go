@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/net/client"
+)
+
+func testCert(t *testing.T, cn string) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	servCert, servX509 := testCert(t, "server")
+	clientCert, clientX509 := testCert(t, "client")
+	servPool := x509.NewCertPool()
+	servPool.AddCert(servX509)
+	clientPool := x509.NewCertPool()
+	clientPool.AddCert(clientX509)
+
+	who := iproto.SF(func(r *iproto.Request) {
+		var cn string
+		if conn := ConnOf(r); conn != nil {
+			if certs := conn.PeerCertificates(); len(certs) > 0 {
+				cn = certs[0].Subject.CommonName
+			}
+		}
+		r.Respond(iproto.RcOK, iproto.Body(cn))
+	})
+	serv := startServer(t, Config{
+		EndPoint: who,
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{servCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientPool,
+		},
+	})
+
+	cl := client.ServerConfig{
+		Address: serv.listener.Addr().String(),
+		Timeout: time.Second,
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      servPool,
+		},
+	}.NewServer()
+	iproto.Run(cl)
+
+	res := iproto.CallMsgBody(cl, msgFast, iproto.Body(nil))
+	if res.Code != iproto.RcOK || string(res.Body) != "client" {
+		t.Errorf("unexpected response %x %q", res.Code, res.Body)
+	}
+
+	cl.Stop()
+	completed, canceled := serv.Shutdown(time.Second)
+	if completed != 0 || canceled != 0 {
+		t.Errorf("completed %d canceled %d", completed, canceled)
+	}
+	if serv.Connections() != 0 {
+		t.Errorf("connections should be closed")
+	}
+}
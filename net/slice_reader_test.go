@@ -0,0 +1,28 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSliceReaderEOF(t *testing.T) {
+	for _, r := range []io.Reader{
+		iotest.OneByteReader(bytes.NewReader([]byte("abcdef"))),
+		/* last data comes together with EOF */
+		iotest.DataErrReader(bytes.NewReader([]byte("abcdef"))),
+	} {
+		sl := SliceReader{r: r, size: 4}
+		if res, err := sl.Read(4); err != nil || string(res) != "abcd" {
+			t.Errorf("%T: first read %q, %v", r, res, err)
+		}
+		/* stream ends in the middle of read, partial data is returned */
+		if res, err := sl.Read(4); err != io.ErrUnexpectedEOF || string(res) != "ef" {
+			t.Errorf("%T: read over EOF %q, %v", r, res, err)
+		}
+		if res, err := sl.Read(4); err != io.EOF || len(res) != 0 {
+			t.Errorf("%T: read after EOF %q, %v", r, res, err)
+		}
+	}
+}
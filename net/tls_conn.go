@@ -0,0 +1,37 @@
+package net
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// TLSConn is a NetConn over TLS connection.
+// CloseWrite sends close_notify and then half-closes underlying connection, so peer reading
+// responses sees EOF as it does with plain TCP. Underlying connection is half-closed even if
+// handshake is not complete yet. CloseRead closes read side of underlying connection.
+type TLSConn struct {
+	*tls.Conn
+	raw net.Conn
+}
+
+var _ NetConn = (*TLSConn)(nil)
+
+func NewTLSConn(conn *tls.Conn, raw net.Conn) *TLSConn {
+	return &TLSConn{Conn: conn, raw: raw}
+}
+
+func (c *TLSConn) CloseWrite() error {
+	err := c.Conn.CloseWrite()
+	if hc, ok := c.raw.(interface{ CloseWrite() error }); ok {
+		/* before handshake close_notify could not be sent, but peer still should see EOF */
+		return hc.CloseWrite()
+	}
+	return err
+}
+
+func (c *TLSConn) CloseRead() error {
+	if hc, ok := c.raw.(interface{ CloseRead() error }); ok {
+		return hc.CloseRead()
+	}
+	return c.raw.Close()
+}
@@ -0,0 +1,36 @@
+package net
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTLSConnCloseWriteBeforeHandshake(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	raw, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	peer, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	c := NewTLSConn(tls.Client(raw, &tls.Config{InsecureSkipVerify: true}), raw)
+	if err := c.CloseWrite(); err != nil {
+		t.Errorf("CloseWrite before handshake: %v", err)
+	}
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := peer.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("peer reads %d bytes, %v after CloseWrite", n, err)
+	}
+}
@@ -25,6 +25,8 @@ type RequestData interface {
 }
 
 type Request struct {
+	/* deadline is accessed atomically, so it goes first to be 64bit aligned */
+	deadline  Epoch
 	Msg       RequestType
 	Id        uint32
 	state     uint32
@@ -37,13 +39,33 @@ type Request struct {
 	timerSet bool
 }
 
+// SetTimeout arms request's timer. If timer is already set, earliest deadline wins.
+// It should be called only by the one who sends request now, but Deadline could be read by anyone.
 func (r *Request) SetTimeout(timeout time.Duration) {
-	if timeout > 0 && !r.timerSet {
+	if timeout <= 0 {
+		return
+	}
+	deadline := NowEpoch().Add(timeout)
+	if !r.timerSet {
 		r.timerSet = true
+		r.setDeadline(deadline)
+		r.timer.After(timeout, r)
+	} else if old := r.Deadline(); !old.Zero() && deadline < old {
+		r.timer.Stop()
+		r.setDeadline(deadline)
 		r.timer.After(timeout, r)
 	}
 }
 
+func (r *Request) setDeadline(deadline Epoch) {
+	atomic.StoreInt64((*int64)(&r.deadline), int64(deadline))
+}
+
+// Deadline returns moment when request will be expired, or zero Epoch if timeout were not set
+func (r *Request) Deadline() Epoch {
+	return Epoch(atomic.LoadInt64((*int64)(&r.deadline)))
+}
+
 func (r *Request) Timer() *Timer {
 	return &r.timer
 }
@@ -140,7 +162,8 @@ func (r *Request) chainResponse(code RetCode, body []byte) {
 	r.state = RsPrepared
 	for chain := r.chain; chain != nil; {
 		chain.Respond(res)
-		if r.state != RsPrepared {
+		/* bookmark could reset request and resend it from other goroutine */
+		if atomic.LoadUint32(&r.state) != RsPrepared {
 			return
 		}
 		chain = chain.unchain()
@@ -164,7 +187,8 @@ func (r *Request) Respond(code RetCode, val interface{}) {
 
 func (r *Request) RespondBytes(code RetCode, body []byte) {
 	r.Lock()
-	if r.state == RsInFly {
+	/* SetPending and SetInFly(nil) change state without lock */
+	if atomic.LoadUint32(&r.state) == RsInFly {
 		r.chainResponse(code, body)
 	}
 	r.Unlock()
@@ -172,7 +196,7 @@ func (r *Request) RespondBytes(code RetCode, body []byte) {
 
 func (r *Request) RespondFail(code RetCode) {
 	r.Lock()
-	if r.state&RsPerforming == 0 {
+	if atomic.LoadUint32(&r.state)&RsPerforming == 0 {
 		r.chainResponse(code, nil)
 	}
 	r.Unlock()
@@ -214,6 +238,7 @@ func (cm *ReqContext) Done() {
 
 func (r *Request) Context() (cx *ReqContext) {
 	cx = &ReqContext{}
+	cx.deadline = r.Deadline()
 	if !r.SetInFly(cx) {
 		return nil
 	}
@@ -9,6 +9,7 @@ type RetCode uint32
 // RcShortBody - response with body shorter, than return code
 // RcIOError - socket were disconnected before answere arrives
 // RcCanceled - ...
+// RcCircuitOpen - request were rejected by open CircuitBreaker
 const (
 	RcOK        = RetCode(0)
 	RcTemporary = RetCode(1)
@@ -26,6 +27,8 @@ const (
 	RcCanceled = RetCode(0xff03)
 	RcIOError  = RetCode(0xfe03)
 	RcTimeout  = RetCode(0xfd03)
+
+	RcCircuitOpen = RetCode(0xfb03)
 )
 
 type Response struct {
@@ -0,0 +1,96 @@
+package iproto
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff returns delay before attempt (attempt starts from 1 for first retry)
+type Backoff func(attempt int) time.Duration
+
+func ConstBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
+	}
+}
+
+// ExpBackoff doubles delay on each attempt starting from min up to max.
+// Up to a half of delay is randomized to avoid retry storms.
+func ExpBackoff(min, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := min
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		if half := int64(d / 2); half > 0 {
+			d = time.Duration(half + rand.Int63n(half+1))
+		}
+		return d
+	}
+}
+
+const DefaultRetryAttempts = 3
+
+// RetryService resends requests which fail with RcIOError, RcTemporary kind codes or one of Codes.
+// Request is resent at most MaxAttempts-1 times, and only if it will not be expired before backoff delay passes.
+// Retrying is built on Bookmark, so StatWrap outside of RetryService measures whole request,
+// and StatWrap inside measures each attempt.
+type RetryService struct {
+	Service
+	MaxAttempts int
+	Backoff     Backoff
+	Codes       map[RetCode]bool
+}
+
+func RetryWrap(s Service, attempts int, backoff Backoff) *RetryService {
+	return &RetryService{Service: s, MaxAttempts: attempts, Backoff: backoff}
+}
+
+func (rs *RetryService) Send(r *Request) {
+	if r.ChainBookmark(&retryBookmark{rs: rs, attempt: 1}) {
+		rs.Service.Send(r)
+	}
+}
+
+func (rs *RetryService) Retryable(code RetCode) bool {
+	return code == RcIOError || code&RcKindMask == RcTemporary || rs.Codes[code]
+}
+
+func (rs *RetryService) maxAttempts() int {
+	if rs.MaxAttempts == 0 {
+		return DefaultRetryAttempts
+	}
+	return rs.MaxAttempts
+}
+
+type retryBookmark struct {
+	Bookmark
+	rs      *RetryService
+	attempt int
+}
+
+func (rb *retryBookmark) Respond(res *Response) {
+	rs := rb.rs
+	if rb.attempt >= rs.maxAttempts() || !rs.Retryable(res.Code) {
+		return
+	}
+	var delay time.Duration
+	if rs.Backoff != nil {
+		delay = rs.Backoff(rb.attempt)
+	}
+	r := rb.Request
+	if dl := r.Deadline(); !dl.Zero() && dl.Remains() <= delay {
+		return
+	}
+	rb.attempt++
+	r.ResetToNew()
+	/* Respond is called with request locked, so we should send it from other goroutine */
+	if delay > 0 {
+		time.AfterFunc(delay, func() { rs.Service.Send(r) })
+	} else {
+		go rs.Service.Send(r)
+	}
+}
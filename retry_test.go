@@ -0,0 +1,115 @@
+package iproto
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/* failingService answers first fails requests with code, and RcOK after that */
+func failingService(code RetCode, fails int32, calls *int32) SF {
+	return func(r *Request) {
+		if atomic.AddInt32(calls, 1) <= fails {
+			r.Respond(code, nil)
+		} else {
+			r.Respond(RcOK, nil)
+		}
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	var calls int32
+	rs := RetryWrap(failingService(RcIOError, 100, &calls), 3, nil)
+	if res := CallMsgBody(rs, 1, Body(nil)); res.Code != RcIOError {
+		t.Errorf("exhausted retries give %x", res.Code)
+	}
+	if calls != 3 {
+		t.Errorf("request is sent %d times, want 3", calls)
+	}
+
+	calls = 0
+	rs = RetryWrap(failingService(RetCode(0x101), 2, &calls), 0, nil)
+	if res := CallMsgBody(rs, 1, Body(nil)); res.Code != RcOK {
+		t.Errorf("temporary error is not retried: %x", res.Code)
+	}
+	if calls != DefaultRetryAttempts {
+		t.Errorf("request is sent %d times, want %d", calls, DefaultRetryAttempts)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var calls int32
+	fatal := RetCode(0x102)
+	rs := RetryWrap(failingService(fatal, 1, &calls), 3, nil)
+	if res := CallMsgBody(rs, 1, Body(nil)); res.Code != fatal || calls != 1 {
+		t.Errorf("fatal code is retried: %x after %d calls", res.Code, calls)
+	}
+
+	calls = 0
+	rs.Codes = map[RetCode]bool{fatal: true}
+	if res := CallMsgBody(rs, 1, Body(nil)); res.Code != RcOK || calls != 2 {
+		t.Errorf("code from Codes is not retried: %x after %d calls", res.Code, calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var calls int32
+	var attempts []int
+	backoff := func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		return 20 * time.Millisecond
+	}
+	rs := RetryWrap(failingService(RcIOError, 2, &calls), 3, backoff)
+	start := time.Now()
+	if res := CallMsgBody(rs, 1, Body(nil)); res.Code != RcOK {
+		t.Errorf("retried request gives %x", res.Code)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("two retries with 20ms backoff took %v", d)
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("backoff called for attempts %v", attempts)
+	}
+
+	for i := 1; i < 10; i++ {
+		if d := ExpBackoff(10*time.Millisecond, 50*time.Millisecond)(i); d < 5*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("ExpBackoff(%d) = %v", i, d)
+		}
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	var calls int32
+	rs := RetryWrap(failingService(RcIOError, 100, &calls), 3, ConstBackoff(100*time.Millisecond))
+	res := make(Chan, 1)
+	req := &Request{Msg: 1, Responder: res}
+	req.SetTimeout(50 * time.Millisecond)
+	rs.Send(req)
+	if r := <-res; r.Code != RcIOError {
+		t.Errorf("request is answered with %x", r.Code)
+	}
+	if calls != 1 {
+		t.Errorf("request is retried after its deadline, %d calls", calls)
+	}
+}
+
+/* earliest deadline wins, and deadline could be read while it is changed */
+func TestRequestDeadline(t *testing.T) {
+	req := &Request{Msg: 1, Responder: make(Chan, 1)}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			req.Deadline()
+		}
+		close(done)
+	}()
+	req.SetTimeout(time.Hour)
+	req.SetTimeout(50 * time.Millisecond)
+	dl := req.Deadline()
+	req.SetTimeout(time.Minute)
+	<-done
+	if req.Deadline() != dl || dl.Remains() > 50*time.Millisecond {
+		t.Errorf("deadline %v is not the earliest", req.Deadline().Time())
+	}
+	req.Timer().Stop()
+}
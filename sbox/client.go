@@ -0,0 +1,187 @@
+package sbox
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+// Error is a failure answered by box or by iproto layer
+type Error struct {
+	Code iproto.RetCode
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("box error 0x%x: %s", uint32(e.Code), e.Msg)
+}
+
+// Is makes errors.Is(err, ErrDuplicateKey) true for any error with same code
+func (e *Error) Is(target error) bool {
+	return isCode(target, e.Code)
+}
+
+func (e *LuaError) Is(target error) bool {
+	return isCode(target, e.Code)
+}
+
+func isCode(target error, code iproto.RetCode) bool {
+	switch t := target.(type) {
+	case *Error:
+		return t.Code == code
+	case *LuaError:
+		return t.Code == code
+	}
+	return false
+}
+
+var (
+	ErrReadOnly             = &Error{RcReadOnly, "box is read only"}
+	ErrLocked               = &Error{RcLocked, "tuple is locked"}
+	ErrMemoryIssue          = &Error{RcMemoryIssue, "memory issue"}
+	ErrNonMaster            = &Error{RcNonMaster, "box is not master"}
+	ErrIllegalParams        = &Error{RcIllegalParams, "illegal parameters"}
+	ErrSecondaryPort        = &Error{RcSecondaryPort, "request to secondary port"}
+	ErrBadIntegrity         = &Error{RcBadIntegrity, "bad integrity"}
+	ErrUnsupportedCommand   = &Error{RcUnsupportedCommand, "unsupported command"}
+	ErrDuplicate            = &Error{RcDuplicate, "duplicate"}
+	ErrWrongField           = &Error{RcWrongField, "wrong field"}
+	ErrWrongNumber          = &Error{RcWrongNumber, "wrong number"}
+	ErrWrongVersion         = &Error{RcWrongVersion, "wrong version"}
+	ErrWalIO                = &Error{RcWalIO, "WAL IO error"}
+	ErrDoesntExists         = &Error{RcDoesntExists, "tuple doesn't exist"}
+	ErrStoredProcNotDefined = &Error{RcStoredProcNotDefined, "stored procedure is not defined"}
+	ErrLuaError             = &Error{RcLuaError, "lua error"}
+	ErrTupleExists          = &Error{RcTupleExists, "tuple already exists"}
+	ErrDuplicateKey         = &Error{RcDuplicateKey, "duplicate key"}
+
+	ErrTimeout     = &Error{iproto.RcTimeout, "timeout"}
+	ErrIOError     = &Error{iproto.RcIOError, "io error"}
+	ErrCanceled    = &Error{iproto.RcCanceled, "canceled"}
+	ErrCircuitOpen = &Error{iproto.RcCircuitOpen, "circuit breaker is open"}
+)
+
+var knownErrors = make(map[iproto.RetCode]*Error)
+
+func init() {
+	for _, e := range []*Error{
+		ErrReadOnly, ErrLocked, ErrMemoryIssue, ErrNonMaster, ErrIllegalParams,
+		ErrSecondaryPort, ErrBadIntegrity, ErrUnsupportedCommand, ErrDuplicate,
+		ErrWrongField, ErrWrongNumber, ErrWrongVersion, ErrWalIO, ErrDoesntExists,
+		ErrStoredProcNotDefined, ErrLuaError, ErrTupleExists, ErrDuplicateKey,
+		ErrTimeout, ErrIOError, ErrCanceled, ErrCircuitOpen,
+	} {
+		knownErrors[e.Code] = e
+	}
+}
+
+// ResponseError returns nil for successful response, and *Error otherwise.
+// Message is taken from response body, or from description of known code if body is empty.
+func ResponseError(res *iproto.Response) error {
+	if res.Code == RcOK {
+		return nil
+	}
+	e := &Error{Code: res.Code}
+	if len(res.Body) > 0 {
+		e.Msg = string(trimZero(res.Body))
+	} else if known := knownErrors[res.Code]; known != nil {
+		e.Msg = known.Msg
+	} else {
+		e.Msg = "unknown error"
+	}
+	return e
+}
+
+func trimZero(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// Client is a typed facade over box service.
+// Methods read returned tuples into out with ReadMany, if out is not nil.
+// For modifications nil out means tuple is not returned by box.
+type Client struct {
+	Service iproto.Service
+}
+
+func NewClient(s iproto.Service) *Client {
+	return &Client{Service: s}
+}
+
+// Do sends request and reads tuples into out. It returns number of tuples found or affected.
+func (c *Client) Do(ctx context.Context, r iproto.RequestData, out interface{}) (int, error) {
+	res := iproto.CallCtx(ctx, c.Service, r)
+	if err := ResponseError(res); err != nil {
+		return 0, err
+	}
+	if out == nil {
+		if len(res.Body) < 4 {
+			return 0, nil
+		}
+		return int(binary.LittleEndian.Uint32(res.Body)), nil
+	}
+	_, total, err := ReadMany(res.Body, out)
+	return total, err
+}
+
+// Select reads all tuples matching keys from index of space
+func (c *Client) Select(ctx context.Context, space, index uint32, keys interface{}, out interface{}) error {
+	_, err := c.Do(ctx, SelectReq{Space: space, Index: index, Limit: SelectAll, Keys: keys}, out)
+	return err
+}
+
+// SelectIndex selects from space registered for type of out by named index (see Space.Select)
+func (c *Client) SelectIndex(ctx context.Context, index string, out interface{}, keys ...interface{}) error {
+	sp := SpaceOf(out)
+	if sp == nil {
+		return fmt.Errorf("No space registered for %T", out)
+	}
+	req, err := sp.Select(index, keys...)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(ctx, req, out)
+	return err
+}
+
+func (c *Client) store(ctx context.Context, space uint32, mode InsertMode, tuple interface{}, out interface{}) error {
+	_, err := c.Do(ctx, StoreReq{Space: space, Return: out != nil, Mode: uint16(mode), Tuple: tuple}, out)
+	return err
+}
+
+// Insert inserts tuple, failing with ErrTupleExists if tuple with same primary key exists
+func (c *Client) Insert(ctx context.Context, space uint32, tuple interface{}, out interface{}) error {
+	return c.store(ctx, space, Insert, tuple, out)
+}
+
+// Replace replaces tuple, failing with ErrDoesntExists if there is no tuple with same primary key
+func (c *Client) Replace(ctx context.Context, space uint32, tuple interface{}, out interface{}) error {
+	return c.store(ctx, space, Replace, tuple, out)
+}
+
+// Store inserts or replaces tuple
+func (c *Client) Store(ctx context.Context, space uint32, tuple interface{}, out interface{}) error {
+	return c.store(ctx, space, InsertOrReplace, tuple, out)
+}
+
+// Update applies ops to tuple with key, and returns number of updated tuples
+func (c *Client) Update(ctx context.Context, space uint32, key interface{}, out interface{}, ops ...Op) (int, error) {
+	return c.Do(ctx, UpdateReq{Space: space, Return: out != nil, Key: key, Ops: ops}, out)
+}
+
+// Delete deletes tuple with key, and returns number of deleted tuples
+func (c *Client) Delete(ctx context.Context, space uint32, key interface{}, out interface{}) (int, error) {
+	return c.Do(ctx, DeleteReq{Space: space, Return: out != nil, Key: key}, out)
+}
+
+// Call calls stored procedure with args (see CallReq). If box fails the call, error is *LuaError,
+// if call is not answered (timeout, io error, cancel), error is *Error.
+func (c *Client) Call(ctx context.Context, name string, args interface{}, out interface{}) error {
+	res := iproto.CallCtx(ctx, c.Service, CallReq{Name: name, Return: true, Args: args})
+	_, _, err := ReadCallResult(res, out)
+	return err
+}
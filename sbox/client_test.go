@@ -0,0 +1,91 @@
+package sbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+func TestClient(t *testing.T) {
+	var storeFlags byte
+	cl := NewClient(iproto.SF(func(r *iproto.Request) {
+		switch r.Msg {
+		case StoreReq{}.IMsg():
+			storeFlags = r.Body[4]
+			r.RespondBytes(RcDuplicateKey, []byte("Duplicate key exists\x00"))
+		case DeleteReq{}.IMsg():
+			r.RespondBytes(RcOK, []byte{1, 0, 0, 0})
+		case CallReq{}.IMsg():
+			if r.Body[5] == 'f' {
+				r.RespondBytes(RcLuaError, nil)
+				return
+			}
+			var w marshal.Writer
+			w.Uint32(1)
+			w.Uint32(5)
+			w.Uint32(1)
+			w.Uint8(4)
+			w.Uint32(7)
+			r.RespondBytes(RcOK, w.Written())
+		default:
+			var w marshal.Writer
+			w.Uint32(1)
+			w.Uint32(5)
+			w.Uint32(1)
+			w.Uint8(4)
+			w.Uint32(42)
+			r.RespondBytes(RcOK, w.Written())
+		}
+	}))
+	ctx := context.Background()
+
+	var got []uint32
+	if err := cl.Select(ctx, 1, 0, uint32(42), &got); err != nil || len(got) != 1 || got[0] != 42 {
+		t.Errorf("select returned %v %v", got, err)
+	}
+
+	err := cl.Insert(ctx, 1, uint32(42), nil)
+	var berr *Error
+	if !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &berr) || berr.Msg != "Duplicate key exists" {
+		t.Errorf("insert returned %v", err)
+	}
+	if storeFlags != byte(Insert)<<1 {
+		t.Errorf("insert sent with flags %x", storeFlags)
+	}
+
+	if n, err := cl.Delete(ctx, 1, uint32(42), nil); err != nil || n != 1 {
+		t.Errorf("delete returned %d %v", n, err)
+	}
+
+	err = cl.Call(ctx, "f", nil, nil)
+	var lerr *LuaError
+	if !errors.Is(err, ErrLuaError) || !errors.As(err, &lerr) {
+		t.Errorf("call returned %v", err)
+	}
+	if errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("lua error should not match other codes")
+	}
+
+	var res []uint32
+	if err = cl.Call(ctx, "g", nil, &res); err != nil || len(res) != 1 || res[0] != 7 {
+		t.Errorf("call returned %v %v", res, err)
+	}
+	if err = cl.Call(ctx, "g", nil, nil); err != nil {
+		t.Errorf("call without out returned %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	cl.Service = iproto.SF(func(r *iproto.Request) {})
+	if err = cl.Select(canceled, 1, 0, uint32(42), &got); !errors.Is(err, ErrCanceled) {
+		t.Errorf("canceled select returned %v", err)
+	}
+	/* transport failure is not an error of procedure */
+	err = cl.Call(canceled, "g", nil, &res)
+	if !errors.Is(err, ErrCanceled) || !errors.As(err, &berr) || errors.As(err, &lerr) {
+		t.Errorf("canceled call returned %T %v", err, err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build go1.18
+
+package sbox
+
+import (
+	"testing"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+type fuzzTail struct {
+	I  int32
+	Ts []uint16 `sbox:"tail"`
+}
+
+type fuzzSplit struct {
+	I  int32
+	Ss []fuzzPair `sbox:"tailsplit"`
+}
+
+type fuzzPair struct {
+	A uint32
+	B string
+}
+
+/* malformed tuples and responses should be reported as errors, but never panic */
+func FuzzReadRawTuple(f *testing.F) {
+	for _, should := range shoulds {
+		f.Add(should.m)
+	}
+	f.Add([]byte{3, 0, 0, 0, 4, 1, 0, 0, 0, 2, 2, 0, 2, 3, 0})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, should := range shoulds {
+			ReadRawTuple(&marshal.Reader{Body: b}, zerovalue_pointer(should.v))
+		}
+		ReadRawTuple(&marshal.Reader{Body: b}, new(fuzzTail))
+		ReadRawTuple(&marshal.Reader{Body: b}, new(fuzzSplit))
+	})
+}
+
+func FuzzReadMany(f *testing.F) {
+	var w marshal.Writer
+	w.IntUint32(2)
+	for i := 0; i < 2; i++ {
+		tuple := write(shoulds[len(shoulds)-1].v)
+		w.IntUint32(len(tuple) - 4)
+		w.Bytes(tuple)
+	}
+	f.Add(w.Written())
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var ss []SStruct
+		ReadMany(b, &ss)
+		var ps []*fuzzTail
+		ReadMany(b, &ps)
+		var arr [2]fuzzSplit
+		ReadMany(b, &arr)
+		var raw [][]byte
+		ReadMany(b, &raw)
+		it := NewTupleIterator(b)
+		for it.Next(new(SStruct)) {
+		}
+	})
+}
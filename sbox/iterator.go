@@ -0,0 +1,105 @@
+package sbox
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// TupleIterator decodes tuples of box response one by one, so big selects are not decoded at once:
+//
+//	it := sbox.NewTupleIterator(res.Body)
+//	var u User
+//	for it.Next(&u) {
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Each tuple is decoded as ReadRawTuple does. Struct with fewer fields than tuple has reads only
+// prefix of tuple, rest of fields are not decoded.
+type TupleIterator struct {
+	/* r[0] is response body, r[1] is current tuple */
+	r     [2]marshal.Reader
+	total int
+	read  int
+	err   error
+}
+
+func NewTupleIterator(body []byte) *TupleIterator {
+	it := &TupleIterator{r: [2]marshal.Reader{{Body: body}, {}}}
+	it.total = it.r[0].IntUint32()
+	it.err = it.r[0].Err
+	return it
+}
+
+// Total is a count of tuples in response
+func (it *TupleIterator) Total() int {
+	return it.total
+}
+
+// Remaining is a count of tuples not yet decoded or skipped
+func (it *TupleIterator) Remaining() int {
+	return it.total - it.read
+}
+
+func (it *TupleIterator) Err() error {
+	return it.err
+}
+
+func (it *TupleIterator) next() bool {
+	if it.err != nil || it.read >= it.total {
+		return false
+	}
+	if it.err = sliceTuple(&it.r); it.err != nil {
+		return false
+	}
+	it.read++
+	return true
+}
+
+// Next decodes next tuple into v, which should be a pointer. It returns false when tuples are over or on error.
+func (it *TupleIterator) Next(v interface{}) bool {
+	if !it.next() {
+		return false
+	}
+	if it.err = ReadRawTuple(&it.r[1], v); it.err != nil {
+		it.err = fmt.Errorf("Tuple %d: %v", it.read-1, it.err)
+		return false
+	}
+	return true
+}
+
+// Skip passes over next tuple without decoding it
+func (it *TupleIterator) Skip() bool {
+	return it.next()
+}
+
+// NextFields decodes first fields of next tuple, each into its pointer, other fields are not decoded.
+// Nil pointer skips field. If tuple is shorter, rest of pointers are left untouched, as ReadRawTuple does for struct.
+func (it *TupleIterator) NextFields(fields ...interface{}) bool {
+	if !it.next() {
+		return false
+	}
+	r := &it.r[1]
+	l := r.IntUint32()
+	for i := 0; i < l && i < len(fields) && r.Err == nil; i++ {
+		if fields[i] == nil {
+			r.Slice(r.Intvar())
+			continue
+		}
+		v := reflect.ValueOf(fields[i])
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			it.err = fmt.Errorf("Tuple %d: field %d should be read into pointer, got %T", it.read-1, i, fields[i])
+			return false
+		}
+		r.ReadValueWithSize(v.Elem(), (*marshal.Reader).Intvar)
+	}
+	if r.Err != nil {
+		it.err = fmt.Errorf("Tuple %d: %v", it.read-1, r.Err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package sbox
+
+import (
+	"testing"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+func TestTupleIterator(t *testing.T) {
+	var w, tw marshal.Writer
+	w.IntUint32(4)
+	for i := 0; i < 4; i++ {
+		WriteTuple(&tw, SStruct{I: int32(i), F: byte(i), B: []byte{1, 2}, S: "abcd"})
+		tuple := tw.Written()
+		w.IntUint32(len(tuple) - 4)
+		w.Bytes(tuple)
+	}
+	body := w.Written()
+
+	it := NewTupleIterator(body)
+	var s SStruct
+	if !it.Next(&s) || s.I != 0 || s.S != "abcd" || it.Remaining() != 3 {
+		t.Fatalf("first tuple %+v %v", s, it.Err())
+	}
+	if !it.Skip() || it.Remaining() != 2 {
+		t.Fatalf("skip failed %v", it.Err())
+	}
+	/* prefix of tuple */
+	var p struct {
+		I int32
+		F byte
+	}
+	if !it.Next(&p) || p.I != 2 || p.F != 2 {
+		t.Fatalf("prefix %+v %v", p, it.Err())
+	}
+	var f byte
+	var str string
+	if !it.NextFields(nil, &f, nil, &str) || f != 3 || str != "abcd" {
+		t.Fatalf("fields %d %q %v", f, str, it.Err())
+	}
+	if it.Next(&s) || it.Err() != nil || it.Remaining() != 0 {
+		t.Fatalf("iterator should be over %v", it.Err())
+	}
+
+	it = NewTupleIterator(body[:len(body)-3])
+	n := 0
+	for it.Next(&s) {
+		n++
+	}
+	if n != 3 || it.Err() == nil {
+		t.Errorf("truncated body: read %d, err %v", n, it.Err())
+	}
+
+	it = NewTupleIterator(body)
+	var i16 int16
+	if it.NextFields(&i16) || it.Err() == nil {
+		t.Errorf("field of wrong size should fail")
+	}
+}
@@ -120,6 +120,21 @@ func (o Op) IWrite(w *marshal.Writer) {
 		w.Write(opmap[o.Op])
 	}
 	switch v := o.Val.(type) {
+	case nil:
+		/* delete has empty operand */
+		w.Intvar(0)
+	case uint8:
+		w.Int8(1)
+		w.Uint8(v)
+	case int8:
+		w.Int8(1)
+		w.Int8(v)
+	case uint16:
+		w.Int8(2)
+		w.Uint16(v)
+	case int16:
+		w.Int8(2)
+		w.Int16(v)
 	case uint32:
 		w.Int8(4)
 		w.Uint32(v)
@@ -132,14 +147,30 @@ func (o Op) IWrite(w *marshal.Writer) {
 	case int64:
 		w.Int8(8)
 		w.Int64(v)
+	case float32:
+		w.Int8(4)
+		w.Float32(v)
+	case float64:
+		w.Int8(8)
+		w.Float64(v)
 	case []byte:
 		w.Intvar(len(v))
 		w.Bytes(v)
 	case string:
 		w.Intvar(len(v))
 		w.String(v)
+	case Slice:
+		w.WriteWithSize(v, (*marshal.Writer).Intvar)
 	default:
 		val := reflect.ValueOf(v)
+		switch val.Kind() {
+		case reflect.Int, reflect.Uint, reflect.Uintptr, reflect.Bool,
+			reflect.Map, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128:
+			if w.Err == nil {
+				w.Err = &marshal.UnsupportedTypeError{Type: val.Type(), Reason: "could not be written as update operand"}
+			}
+			return
+		}
 		wr := marshal.WriterFor(val.Type())
 		wr.WithSize(w, val, (*marshal.Writer).Intvar)
 	}
@@ -0,0 +1,140 @@
+package sbox
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// OpsBuilder builds and validates update operations:
+//
+//	ops, err := sbox.Ops().Set(3, "x").Add(5, int32(1)).Splice(7, 0, 2, "ab").Build()
+//
+// First invalid operation is remembered, following calls are ignored, and Build returns its error.
+//
+// Operations are applied by box in order, and Insert and Delete shift numbers of following fields.
+type OpsBuilder struct {
+	ops []Op
+	err error
+	/* operand width of arithmetic ops per field, since last Insert or Delete */
+	width map[uint32]int
+}
+
+func Ops() *OpsBuilder {
+	return &OpsBuilder{}
+}
+
+func (b *OpsBuilder) fail(format string, args ...interface{}) *OpsBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, args...)
+	}
+	return b
+}
+
+func (b *OpsBuilder) add(field uint32, op OpKind, val interface{}) *OpsBuilder {
+	if b.err == nil {
+		b.ops = append(b.ops, Op{Field: field, Op: op, Val: val})
+	}
+	return b
+}
+
+/* operandSize is a size of operand on the wire, or 0 for variable sized */
+func operandSize(val interface{}) (int, bool) {
+	switch val.(type) {
+	case string, []byte:
+		return 0, true
+	case Slice, nil:
+		return 0, false
+	}
+	rt := reflect.TypeOf(val)
+	switch rt.Kind() {
+	case reflect.String:
+		return 0, true
+	case reflect.Slice, reflect.Array:
+		return 0, rt.Elem().Kind() == reflect.Uint8
+	}
+	sz := wireSize(rt)
+	return sz, sz > 0
+}
+
+// Set assigns val to field
+func (b *OpsBuilder) Set(field uint32, val interface{}) *OpsBuilder {
+	if _, ok := operandSize(val); !ok {
+		return b.fail("Could not set field %d to %T", field, val)
+	}
+	return b.add(field, OpSet, val)
+}
+
+func (b *OpsBuilder) arith(field uint32, op OpKind, val interface{}) *OpsBuilder {
+	switch val.(type) {
+	case int32, uint32, int64, uint64:
+	default:
+		return b.fail("Operand of %c on field %d should be 32 or 64 bit integer, got %T", op, field, val)
+	}
+	sz, _ := operandSize(val)
+	if b.width == nil {
+		b.width = make(map[uint32]int)
+	}
+	if w, ok := b.width[field]; ok && w != sz {
+		return b.fail("Arithmetic on field %d with operands of %d and %d bytes", field, w, sz)
+	}
+	b.width[field] = sz
+	return b.add(field, op, val)
+}
+
+// Add adds 32 or 64 bit integer to field of same width
+func (b *OpsBuilder) Add(field uint32, val interface{}) *OpsBuilder {
+	return b.arith(field, OpAdd, val)
+}
+
+func (b *OpsBuilder) And(field uint32, val interface{}) *OpsBuilder {
+	return b.arith(field, OpAnd, val)
+}
+
+func (b *OpsBuilder) Or(field uint32, val interface{}) *OpsBuilder {
+	return b.arith(field, OpOr, val)
+}
+
+func (b *OpsBuilder) Xor(field uint32, val interface{}) *OpsBuilder {
+	return b.arith(field, OpXor, val)
+}
+
+// Splice replaces length bytes of field starting at offset with val (string or []byte).
+// Negative offset counts from the end of field, negative length leaves that many bytes at the end.
+func (b *OpsBuilder) Splice(field uint32, offset, length int32, val interface{}) *OpsBuilder {
+	switch val.(type) {
+	case string, []byte:
+	default:
+		return b.fail("Splice of field %d with %T, expect string or []byte", field, val)
+	}
+	return b.add(field, OpSplice, Slice{Offset: offset, Length: length, Val: val})
+}
+
+// Delete removes field, following fields are shifted left
+func (b *OpsBuilder) Delete(field uint32) *OpsBuilder {
+	b.width = nil
+	return b.add(field, OpDelete, nil)
+}
+
+// Insert inserts val before field, following fields are shifted right
+func (b *OpsBuilder) Insert(field uint32, val interface{}) *OpsBuilder {
+	if _, ok := operandSize(val); !ok {
+		return b.fail("Could not insert %T as field %d", val, field)
+	}
+	b.width = nil
+	return b.add(field, OpInsert, val)
+}
+
+func (b *OpsBuilder) Err() error {
+	return b.err
+}
+
+// Build returns operations, or error of first invalid one. Update without operations is an error too.
+func (b *OpsBuilder) Build() ([]Op, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.ops) == 0 {
+		return nil, fmt.Errorf("Update without operations")
+	}
+	return b.ops, nil
+}
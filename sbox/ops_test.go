@@ -0,0 +1,71 @@
+package sbox
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+func TestOpsBuilder(t *testing.T) {
+	ops, err := Ops().
+		Set(1, uint16(7)).
+		Add(2, int32(1)).Add(2, uint32(2)).
+		Splice(3, 1, -1, "ab").
+		Delete(4).
+		Add(2, int64(3)).
+		Insert(5, float64(1)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w marshal.Writer
+	w.Write(UpdateReq{Space: 1, Key: uint32(1), Ops: ops})
+	expect := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 4, 1, 0, 0, 0,
+		7, 0, 0, 0,
+		1, 0, 0, 0, 0, 2, 7, 0,
+		2, 0, 0, 0, 1, 4, 1, 0, 0, 0,
+		2, 0, 0, 0, 1, 4, 2, 0, 0, 0,
+		3, 0, 0, 0, 5, 13, 4, 1, 0, 0, 0, 4, 0xff, 0xff, 0xff, 0xff, 2, 'a', 'b',
+		4, 0, 0, 0, 6, 0,
+		2, 0, 0, 0, 1, 8, 3, 0, 0, 0, 0, 0, 0, 0,
+		5, 0, 0, 0, 7, 8, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f,
+	}
+	if !bytes.Equal(w.Written(), expect) {
+		t.Errorf("update ops\ngot  [% x]\nneed [% x]", w.Written(), expect)
+	}
+
+	bad := []*OpsBuilder{
+		Ops().Add(1, int16(1)),
+		Ops().Add(1, 1),
+		Ops().Add(1, int32(1)).Xor(1, uint64(1)),
+		Ops().Set(1, nil),
+		Ops().Set(1, true),
+		Ops().Splice(1, 0, 1, uint32(1)),
+		Ops().Insert(1, Slice{}),
+	}
+	for i, b := range bad {
+		/* valid operation after invalid one does not clear error */
+		if _, err := b.Set(9, "x").Build(); err == nil {
+			t.Errorf("builder %d should fail", i)
+		}
+	}
+	if _, err := Ops().Build(); err == nil {
+		t.Errorf("empty update should fail")
+	}
+
+	w.Reset()
+	w.Write(Op{Field: 1, Op: OpDelete})
+	if !bytes.Equal(w.Written(), []byte{1, 0, 0, 0, 6, 0}) {
+		t.Errorf("delete without operand [% x]", w.Written())
+	}
+	w.Reset()
+	w.Write(Op{Field: 1, Op: OpSet, Val: 1})
+	var ute *marshal.UnsupportedTypeError
+	if !errors.As(w.Err, &ute) || ute.Type != reflect.TypeOf(1) {
+		t.Errorf("int operand should fail with UnsupportedTypeError, got %v", w.Err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/funny-falcon/go-iproto/marshal"
@@ -12,6 +11,13 @@ import (
 
 var _ = log.Print
 
+// TupleReader is implemented by types with generated tuple decoder (cmd/iprotogen -sbox)
+type TupleReader interface {
+	IReadTuple(r *marshal.Reader)
+}
+
+var tupleReader = reflect.TypeOf(new(TupleReader)).Elem()
+
 func oneFieldTuple(r *marshal.Reader, sz int) bool {
 	var l, s int
 	if l = r.IntUint32(); l >= 1 {
@@ -39,6 +45,10 @@ func ReadRawTuple(r *marshal.Reader, i interface{}) error {
 	if i == nil {
 		return nil
 	}
+	if tr, ok := i.(TupleReader); ok {
+		tr.IReadTuple(r)
+		return r.Err
+	}
 	val := reflect.ValueOf(i)
 	rt := val.Type()
 	rd := reader(rt)
@@ -85,7 +95,9 @@ type TReader struct {
 }
 
 func (t *TReader) sliceFixed(r *marshal.Reader, v reflect.Value) {
-	if l := r.IntUint32(); l >= v.Len() {
+	if l := r.IntUint32(); !r.CheckCount(l, 1) {
+		return
+	} else if l >= v.Len() {
 		for i := 0; i < l; i++ {
 			t.Reader.Elem.WithSize(r, v.Index(i), (*marshal.Reader).Intvar)
 		}
@@ -95,7 +107,11 @@ func (t *TReader) sliceFixed(r *marshal.Reader, v reflect.Value) {
 }
 
 func (t *TReader) sliceAuto(r *marshal.Reader, v reflect.Value) {
+	/* each field takes at least a byte of its size */
 	l := r.IntUint32()
+	if !r.CheckCount(l, 1) {
+		return
+	}
 	if v.CanSet() {
 		v.Set(reflect.MakeSlice(v.Type(), l, l))
 	} else if l < v.Len() {
@@ -179,6 +195,17 @@ func (t *TReader) Fill() {
 		}
 	case reflect.Struct:
 		t.FillStruct()
+		if reflect.PtrTo(rt).Implements(tupleReader) {
+			fixed := t.Fixed
+			t.Fixed = func(r *marshal.Reader, v reflect.Value) {
+				if v.CanAddr() {
+					v.Addr().Interface().(TupleReader).IReadTuple(r)
+				} else {
+					fixed(r, v)
+				}
+			}
+			t.Auto = t.Fixed
+		}
 	case reflect.Int8, reflect.Uint8, reflect.Uint16, reflect.Int16,
 		reflect.Uint32, reflect.Int32, reflect.Uint64, reflect.Int64,
 		reflect.Float32, reflect.Float64:
@@ -188,10 +215,19 @@ func (t *TReader) Fill() {
 		t.Fixed = t.string
 		t.Auto = t.string
 	default:
-		log.Panicf("Don't know how to read type %+v as a tuple", rt)
+		t.fail(&marshal.UnsupportedTypeError{Type: rt, Reason: "could not be read as a tuple"})
 	}
 }
 
+func (t *TReader) fail(err error) {
+	t.Fixed = func(r *marshal.Reader, v reflect.Value) {
+		if r.Err == nil {
+			r.Err = err
+		}
+	}
+	t.Auto = t.Fixed
+}
+
 func (sw *TReader) structFixed(r *marshal.Reader, v reflect.Value) {
 	l := r.IntUint32()
 	/*flds := sw.Reader.Flds
@@ -224,6 +260,9 @@ func (sw *TReader) structAuto(r *marshal.Reader, v reflect.Value) {
 		return
 	}
 	l := r.IntUint32()
+	if !r.CheckCount(l, 1) {
+		return
+	}
 	flds := sw.Reader.Flds
 	switch sw.Tail {
 	/*case NoTail:
@@ -240,8 +279,7 @@ func (sw *TReader) structAuto(r *marshal.Reader, v reflect.Value) {
 		tail := l - len(flds) + 1
 		last := flds[len(flds)-1]
 		if sw.Tail == TailSplit {
-			llast := len(last.Flds)
-			tail /= llast
+			tail /= len(last.Elem.Flds)
 		}
 		last.TReader.SetCount(v.Field(last.I), tail)
 	}
@@ -265,52 +303,39 @@ func (sw *TReader) structRead(r *marshal.Reader, k int, v reflect.Value) {
 	case NoTail:
 	case Tail:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
 		for i := 0; i < l && n+i < k; i++ {
 			val := fv.Index(i)
-			fs.WithSize(r, val, (*marshal.Reader).Intvar)
+			fs.Elem.WithSize(r, val, (*marshal.Reader).Intvar)
 		}
 	case TailSplit:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
-		fss := fs.TReader.Flds
+		fss := fs.Elem.Flds
 		fl := len(fss)
 		for i := 0; i < l; i++ {
 			str := fv.Index(i)
 			for j := 0; j < fl && n+i*fl+j < k; j++ {
-				fss[i].WithSize(r, str.Field(i), (*marshal.Reader).Intvar)
+				fss[j].WithSize(r, str.Field(fss[j].I), (*marshal.Reader).Intvar)
 			}
 		}
 	}
 }
 
 func (t *TReader) FillStruct() {
+	if err := t.Reader.Err; err != nil {
+		t.fail(err)
+		return
+	}
 	t.Fixed = t.structFixed
 	t.Auto = t.structAuto
 	for i := range t.Reader.Flds {
 		fld := &t.Reader.Flds[i]
-		ipro := fld.Tag.Get("sbox")
-
-		for _, m := range strings.Split(ipro, ",") {
-			if t.Tail != NoTail {
-				log.Panicf("Sbox Tail could be only last field in a struct %+v", t.Reader.Type)
-			}
-			if m == "tail" {
-				if fld.Type.Kind() != reflect.Slice {
-					log.Panicf("Could apply sbox:tail only for slices")
-				}
-				t.Tail = Tail
-			} else if m == "tailsplit" {
-				if fld.Type.Kind() != reflect.Slice {
-					log.Panicf("Could apply sbox:tailsplit only for slices")
-				}
-				if fld.Type.Elem().Kind() != reflect.Struct {
-					log.Panicf("Could apply sbox:tailsplit only for slices of struct")
-				}
-				t.Tail = TailSplit
-			}
+		if reason := t.Tail.apply(fld.Type, fld.Tag.Get("sbox")); reason != "" {
+			t.fail(badTag(t.Reader.Type, fld.I, reason))
+			return
 		}
 	}
 }
@@ -0,0 +1,246 @@
+package sbox
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// Member is a box in ReplicaSet
+type Member struct {
+	Name    string
+	Service iproto.Service
+}
+
+// ReplicaSet sends modifications (store, update, delete and calls for which WriteProc returns true)
+// to master, and spreads selects and other calls across replicas in round robin.
+// Requests other than box requests are treated as modifications.
+//
+// When master answers RcNonMaster or RcReadOnly, master is rediscovered and request is resent,
+// at most once per member. Master is discovered with Probe, called for members in order.
+// Without Probe next member is assumed to be master, and resent request itself checks it.
+type ReplicaSet struct {
+	// WriteProc reports whether stored procedure modifies data
+	WriteProc func(name string) bool
+	// Probe reports whether member is master now. It may block.
+	Probe func(m Member) bool
+
+	members []member
+
+	m           sync.Mutex
+	master      int
+	discovering chan struct{}
+	discoveries uint64
+	rr          uint32
+}
+
+type member struct {
+	Member
+	reads, writes, failovers uint64
+}
+
+// NewReplicaSet panics without members, since there would be nothing to send requests to
+func NewReplicaSet(members ...Member) *ReplicaSet {
+	if len(members) == 0 {
+		log.Panicf("ReplicaSet needs at least one member")
+	}
+	rs := &ReplicaSet{master: -1}
+	for _, m := range members {
+		rs.members = append(rs.members, member{Member: m})
+	}
+	return rs
+}
+
+// MemberStatus is a member state reported by Topology
+type MemberStatus struct {
+	Name   string
+	Master bool
+	// Reads and Writes are numbers of requests sent to member,
+	// Failovers is number of times member answered RcNonMaster or RcReadOnly
+	Reads, Writes, Failovers uint64
+}
+
+type Topology struct {
+	// Master is name of current master, or empty if it is not known
+	Master      string
+	Members     []MemberStatus
+	Discoveries uint64
+}
+
+// Topology returns current view of replica set for monitoring
+func (rs *ReplicaSet) Topology() (t Topology) {
+	rs.m.Lock()
+	master := rs.master
+	t.Discoveries = rs.discoveries
+	rs.m.Unlock()
+	for i := range rs.members {
+		m := &rs.members[i]
+		t.Members = append(t.Members, MemberStatus{
+			Name:      m.Name,
+			Master:    i == master,
+			Reads:     atomic.LoadUint64(&m.reads),
+			Writes:    atomic.LoadUint64(&m.writes),
+			Failovers: atomic.LoadUint64(&m.failovers),
+		})
+		if i == master {
+			t.Master = m.Name
+		}
+	}
+	return
+}
+
+func (rs *ReplicaSet) DefaultTimeout() time.Duration {
+	return 0
+}
+
+func (rs *ReplicaSet) Runned() bool {
+	for _, m := range rs.members {
+		if !m.Service.Runned() {
+			return false
+		}
+	}
+	return true
+}
+
+func (rs *ReplicaSet) isWrite(r *iproto.Request) bool {
+	switch r.Msg {
+	case SelectReq{}.IMsg():
+		return false
+	case RPCReq{}.IMsg():
+		if rs.WriteProc == nil {
+			return false
+		}
+		rd := marshal.Reader{Body: r.Body}
+		rd.Uint32() /* flags */
+		sz := rd.Intvar()
+		if rd.Err != nil || sz < 0 {
+			return false
+		}
+		name := rd.String(sz)
+		return rd.Err == nil && rs.WriteProc(name)
+	}
+	return true
+}
+
+func (rs *ReplicaSet) Send(r *iproto.Request) {
+	if !rs.isWrite(r) {
+		rs.sendRead(r)
+		return
+	}
+	rb := &replicaBookmark{rs: rs}
+	if !r.ChainBookmark(rb) {
+		return
+	}
+	rs.m.Lock()
+	master := rs.master
+	rs.m.Unlock()
+	if master < 0 {
+		/* Probe may block, so discover in other goroutine */
+		go func() { rb.sendTo(r, rs.discover(-1)) }()
+		return
+	}
+	rb.sendTo(r, master)
+}
+
+func (rs *ReplicaSet) sendRead(r *iproto.Request) {
+	n := uint32(len(rs.members))
+	rs.m.Lock()
+	master := rs.master
+	rs.m.Unlock()
+	rr := atomic.AddUint32(&rs.rr, 1)
+	var i int
+	if master >= 0 && n > 1 {
+		/* skip master without giving its share to next member */
+		if i = int(rr % (n - 1)); i >= master {
+			i++
+		}
+	} else {
+		i = int(rr % n)
+	}
+	m := &rs.members[i]
+	atomic.AddUint64(&m.reads, 1)
+	m.Service.Send(r)
+}
+
+/* discover finds new master after failed one. Concurrent discoveries wait for the first one. */
+func (rs *ReplicaSet) discover(failed int) int {
+	rs.m.Lock()
+	if rs.master >= 0 && rs.master != failed {
+		master := rs.master
+		rs.m.Unlock()
+		return master
+	}
+	if ch := rs.discovering; ch != nil {
+		rs.m.Unlock()
+		<-ch
+		rs.m.Lock()
+		master := rs.master
+		rs.m.Unlock()
+		return master
+	}
+	ch := make(chan struct{})
+	rs.discovering = ch
+	rs.master = -1
+	rs.discoveries++
+	rs.m.Unlock()
+
+	found := -1
+	if rs.Probe != nil {
+		for i, m := range rs.members {
+			if rs.Probe(m.Member) {
+				found = i
+				break
+			}
+		}
+	} else {
+		found = (failed + 1) % len(rs.members)
+	}
+
+	rs.m.Lock()
+	rs.master = found
+	rs.discovering = nil
+	rs.m.Unlock()
+	close(ch)
+	return found
+}
+
+type replicaBookmark struct {
+	iproto.Bookmark
+	rs      *ReplicaSet
+	member  int
+	attempt int
+}
+
+/* request is passed by caller, because rb.Request could be read only under request lock */
+func (rb *replicaBookmark) sendTo(r *iproto.Request, i int) {
+	if i < 0 {
+		rb.member = -1
+		r.RespondFail(RcNonMaster)
+		return
+	}
+	rb.member = i
+	rb.attempt++
+	m := &rb.rs.members[i]
+	atomic.AddUint64(&m.writes, 1)
+	m.Service.Send(r)
+}
+
+func (rb *replicaBookmark) Respond(res *iproto.Response) {
+	if rb.member < 0 || res.Code != RcNonMaster && res.Code != RcReadOnly {
+		return
+	}
+	rs := rb.rs
+	atomic.AddUint64(&rs.members[rb.member].failovers, 1)
+	if rb.attempt >= len(rs.members) {
+		return
+	}
+	r := rb.Request
+	r.ResetToNew()
+	/* Respond is called with request locked, and Probe may block */
+	failed := rb.member
+	go func() { rb.sendTo(r, rs.discover(failed)) }()
+}
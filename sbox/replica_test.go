@@ -0,0 +1,147 @@
+package sbox
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+)
+
+/* fakeBox answers with its name, modifications are answered with RcNonMaster unless it is master */
+type fakeBox struct {
+	name   string
+	master int32
+}
+
+func (f *fakeBox) Service() iproto.Service {
+	return iproto.SF(func(r *iproto.Request) {
+		if r.Msg != 17 && r.Msg != 22 && atomic.LoadInt32(&f.master) == 0 {
+			r.RespondBytes(RcNonMaster, nil)
+			return
+		}
+		r.RespondBytes(RcOK, []byte(f.name))
+	})
+}
+
+func replicaSet(names ...string) (*ReplicaSet, []*fakeBox) {
+	var boxes []*fakeBox
+	var members []Member
+	for _, n := range names {
+		b := &fakeBox{name: n}
+		boxes = append(boxes, b)
+		members = append(members, Member{Name: n, Service: b.Service()})
+	}
+	return NewReplicaSet(members...), boxes
+}
+
+func expectAnswer(t *testing.T, rs *ReplicaSet, r iproto.RequestData, code iproto.RetCode, name string) {
+	res := iproto.Call(rs, r)
+	if res.Code != code || string(res.Body) != name {
+		t.Fatalf("expected %x %q, got %x %q", code, name, res.Code, res.Body)
+	}
+}
+
+func TestReplicaSetFailover(t *testing.T) {
+	rs, boxes := replicaSet("a", "b", "c")
+	atomic.StoreInt32(&boxes[2].master, 1)
+
+	expectAnswer(t, rs, StoreReq{Space: 1, Tuple: uint32(1)}, RcOK, "c")
+	topo := rs.Topology()
+	if topo.Master != "c" || topo.Members[0].Failovers != 1 || topo.Members[1].Failovers != 1 {
+		t.Errorf("unexpected topology %+v", topo)
+	}
+	for i := 0; i < 4; i++ {
+		res := iproto.Call(rs, SelectReq{Space: 1, Keys: uint32(1)})
+		if string(res.Body) == "c" {
+			t.Errorf("select should go to replicas")
+		}
+	}
+
+	atomic.StoreInt32(&boxes[2].master, 0)
+	atomic.StoreInt32(&boxes[0].master, 1)
+	expectAnswer(t, rs, DeleteReq{Space: 1, Key: uint32(1)}, RcOK, "a")
+	if topo = rs.Topology(); topo.Master != "a" || topo.Members[2].Writes != 2 {
+		t.Errorf("unexpected topology %+v", topo)
+	}
+
+	atomic.StoreInt32(&boxes[0].master, 0)
+	expectAnswer(t, rs, DeleteReq{Space: 1, Key: uint32(1)}, RcNonMaster, "")
+}
+
+func TestReplicaSetReadsSpread(t *testing.T) {
+	rs, boxes := replicaSet("a", "b", "c")
+	atomic.StoreInt32(&boxes[0].master, 1)
+	expectAnswer(t, rs, StoreReq{Space: 1, Tuple: uint32(1)}, RcOK, "a")
+	for i := 0; i < 6; i++ {
+		iproto.Call(rs, SelectReq{Space: 1, Keys: uint32(1)})
+	}
+	topo := rs.Topology()
+	if topo.Members[0].Reads != 0 || topo.Members[1].Reads != 3 || topo.Members[2].Reads != 3 {
+		t.Errorf("reads should be spread evenly across replicas %+v", topo)
+	}
+}
+
+func TestReplicaSetProbe(t *testing.T) {
+	rs, boxes := replicaSet("a", "b", "c")
+	var probes int32
+	rs.Probe = func(m Member) bool {
+		atomic.AddInt32(&probes, 1)
+		for _, b := range boxes {
+			if b.name == m.Name {
+				return atomic.LoadInt32(&b.master) != 0
+			}
+		}
+		return false
+	}
+	rs.WriteProc = func(name string) bool { return name == "write" }
+	atomic.StoreInt32(&boxes[1].master, 1)
+
+	expectAnswer(t, rs, RPCReq{Name: "write"}, RcOK, "b")
+	if topo := rs.Topology(); topo.Master != "b" || topo.Members[0].Writes != 0 || atomic.LoadInt32(&probes) != 2 {
+		t.Errorf("master should be probed before write: %+v, %d probes", topo, probes)
+	}
+	if res := iproto.Call(rs, RPCReq{Name: "read"}); string(res.Body) == "b" {
+		t.Errorf("read call should go to replica")
+	}
+
+	atomic.StoreInt32(&boxes[1].master, 0)
+	expectAnswer(t, rs, UpdateReq{Space: 1, Key: uint32(1)}, RcNonMaster, "")
+	if topo := rs.Topology(); topo.Master != "" || topo.Discoveries != 2 {
+		t.Errorf("master should be unknown: %+v", topo)
+	}
+}
+
+func TestReplicaSetProbeBlocks(t *testing.T) {
+	rs, boxes := replicaSet("a", "b")
+	atomic.StoreInt32(&boxes[1].master, 1)
+	release := make(chan struct{})
+	rs.Probe = func(m Member) bool {
+		<-release
+		return m.Name == "b"
+	}
+	sent := make(chan iproto.Chan)
+	go func() {
+		_, res := iproto.Send(rs, StoreReq{Space: 1, Tuple: uint32(1)})
+		sent <- res
+	}()
+	var res iproto.Chan
+	select {
+	case res = <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Send waits for Probe")
+	}
+	close(release)
+	if r := <-res; r.Code != RcOK || string(r.Body) != "b" {
+		t.Errorf("expected %x %q, got %x %q", RcOK, "b", r.Code, r.Body)
+	}
+}
+
+func TestReplicaSetEmpty(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewReplicaSet should panic without members")
+		}
+	}()
+	NewReplicaSet()
+}
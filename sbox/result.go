@@ -78,7 +78,13 @@ func readInterface(r *[2]marshal.Reader, v reflect.Value, l int) int {
 	case reflect.Array, reflect.Slice:
 		return readFixedArray(r, v, l)
 	}
-	log.Panicf("Don't know how to read tuple into %v", v.Type())
+	return unsupported(r, v.Type())
+}
+
+func unsupported(r *[2]marshal.Reader, rt reflect.Type) int {
+	if r[0].Err == nil {
+		r[0].Err = &marshal.UnsupportedTypeError{Type: rt, Reason: "could not read tuples into it"}
+	}
 	return 0
 }
 
@@ -97,10 +103,8 @@ func readFixedArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
 		return i
 	case reflect.Interface:
 		return readInterfaceArray(r, v, l)
-	default:
-		log.Panicf("Do not know how to read tuple into %+v", tel)
 	}
-	return 0
+	return unsupported(r, tel)
 }
 
 func readArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
@@ -112,7 +116,7 @@ func readArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
 			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Float32, reflect.Float64, reflect.String:
 		default:
-			log.Panicf("Do not know how to read tuple into %+v", tel)
+			return unsupported(r, tel)
 		}
 		fallthrough
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
@@ -129,10 +133,8 @@ func readArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
 		return i
 	case reflect.Interface:
 		return readInterfaceArray(r, v, l)
-	default:
-		log.Panicf("Do not know how to read tuple into %+v", tel)
 	}
-	return 0
+	return unsupported(r, tel)
 }
 
 func readSlice(r *[2]marshal.Reader, v reflect.Value, l int) int {
@@ -144,13 +146,17 @@ func readSlice(r *[2]marshal.Reader, v reflect.Value, l int) int {
 			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 			reflect.Float32, reflect.Float64, reflect.String:
 		default:
-			log.Panicf("Do not know how to read tuple into %+v", tel)
+			return unsupported(r, tel)
 		}
 		fallthrough
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Float32, reflect.Float64, reflect.Struct, reflect.String, reflect.Ptr:
 		rd := reader(tel)
+		/* each tuple takes at least its size and cardinality */
+		if !r[0].CheckCount(l, 8) {
+			return 0
+		}
 		v.Set(reflect.MakeSlice(v.Type(), l, l))
 		var i int
 		for ; i < l; i++ {
@@ -161,10 +167,8 @@ func readSlice(r *[2]marshal.Reader, v reflect.Value, l int) int {
 		return i
 	case reflect.Interface:
 		return readInterfaceArray(r, v, l)
-	default:
-		log.Panicf("Do not know how to read tuple into %+v", tel)
 	}
-	return 0
+	return unsupported(r, tel)
 }
 
 func readInterfaceArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
@@ -179,15 +183,20 @@ func readInterfaceArray(r *[2]marshal.Reader, v reflect.Value, l int) int {
 	return i
 }
 
-func oneTuple(r *[2]marshal.Reader, v reflect.Value, rd *TReader) error {
+/* sliceTuple slices next tuple of response in r[0] into r[1] */
+func sliceTuple(r *[2]marshal.Reader) error {
 	if r[0].Err != nil {
 		return r[0].Err
 	}
 	sz := r[0].IntUint32()
-	r[1].Body = r[0].Slice(sz + 4)
-	if r[0].Err != nil {
-		log.Printf("oneTuple header read error: %s", r[0].Err)
-		return r[0].Err
+	r[1] = marshal.Reader{Body: r[0].Slice(sz + 4)}
+	return r[0].Err
+}
+
+func oneTuple(r *[2]marshal.Reader, v reflect.Value, rd *TReader) error {
+	if err := sliceTuple(r); err != nil {
+		log.Printf("oneTuple header read error: %s", err)
+		return err
 	}
 	body := r[1].Body
 	if rd == nil {
@@ -1,6 +1,10 @@
 package sbox
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
 	"github.com/funny-falcon/go-iproto"
 	"github.com/funny-falcon/go-iproto/marshal"
 )
@@ -69,3 +73,74 @@ func (s RPCReq) IWrite(w *marshal.Writer) {
 func (s RPCReq) IMsg() iproto.RequestType {
 	return 22
 }
+
+// ReturnTuple flag asks box to return tuples produced by procedure
+const ReturnTuple = uint32(1)
+
+// CallReq calls stored procedure with arbitrary typed arguments.
+// Args are written with WriteTuple, so struct, slice or []interface{} gives one argument per field.
+// Result could be read with ReadCallResult.
+type CallReq struct {
+	Name   string
+	Return bool
+	Args   interface{}
+}
+
+func (c CallReq) IWrite(w *marshal.Writer) {
+	var flags uint32
+	if c.Return {
+		flags = ReturnTuple
+	}
+	w.Uint32(flags)
+	stringvar(w, c.Name)
+	if c.Args == nil {
+		w.Uint32(0)
+	} else {
+		WriteTuple(w, c.Args)
+	}
+}
+
+func (c CallReq) IMsg() iproto.RequestType {
+	return 22
+}
+
+// LuaError is an error returned by box on call: error raised by procedure (RcLuaError)
+// or other failure, like RcStoredProcNotDefined
+type LuaError struct {
+	Code    iproto.RetCode
+	Message string
+}
+
+func (e *LuaError) Error() string {
+	return fmt.Sprintf("box call error 0x%x: %s", uint32(e.Code), e.Message)
+}
+
+// ReadCallResult reads tuples returned by call into v with ReadMany, or only returns their number if v is nil.
+// If box failed the call, err is *LuaError. If call were not answered by box (timeout, io error,
+// cancel and other failures of iproto layer), err is *Error.
+func ReadCallResult(res *iproto.Response, v interface{}) (read, total int, err error) {
+	if res.Code != iproto.RcOK {
+		if transportCode(res.Code) {
+			return 0, 0, ResponseError(res)
+		}
+		msg := string(bytes.TrimRight(res.Body, "\x00"))
+		return 0, 0, &LuaError{Code: res.Code, Message: msg}
+	}
+	if v == nil {
+		if len(res.Body) >= 4 {
+			total = int(binary.LittleEndian.Uint32(res.Body))
+		}
+		return 0, total, nil
+	}
+	return ReadMany(res.Body, v)
+}
+
+/* transportCode reports whether code is set by iproto layer, not answered by box */
+func transportCode(code iproto.RetCode) bool {
+	switch code {
+	case iproto.RcShutdown, iproto.RcIOError, iproto.RcTimeout, iproto.RcCircuitOpen,
+		iproto.RcInternalError, iproto.RcProtocolError:
+		return true
+	}
+	return false
+}
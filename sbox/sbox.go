@@ -1,7 +1,11 @@
 package sbox
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
 )
 
 type TailType int
@@ -12,6 +16,32 @@ const (
 	TailSplit
 )
 
+/* apply takes sbox tag of next struct field into account, it returns a reason if tag is wrong */
+func (t *TailType) apply(ft reflect.Type, tag string) string {
+	for _, m := range strings.Split(tag, ",") {
+		if *t != NoTail {
+			return "sbox tail could be only last field in a struct"
+		}
+		if m == "tail" {
+			if ft.Kind() != reflect.Slice {
+				return "sbox:tail could be applied only for slices"
+			}
+			*t = Tail
+		} else if m == "tailsplit" {
+			if ft.Kind() != reflect.Slice || ft.Elem().Kind() != reflect.Struct {
+				return "sbox:tailsplit could be applied only for slices of struct"
+			}
+			*t = TailSplit
+		}
+	}
+	return ""
+}
+
+func badTag(rt reflect.Type, i int, reason string) error {
+	fld := rt.Field(i)
+	return &marshal.BadTagError{Struct: rt, Field: fld.Name, Tag: fld.Tag, Reason: reason}
+}
+
 const (
 	RcOK                   = iproto.RcOK
 	RcReadOnly             = iproto.RetCode(0x0401)
@@ -3,6 +3,7 @@ package sbox
 import (
 	"bytes"
 
+	"github.com/funny-falcon/go-iproto"
 	"github.com/funny-falcon/go-iproto/marshal"
 
 	//"reflect"
@@ -103,3 +104,29 @@ func TestSelect(t *testing.T) {
 		t.Errorf("Select not match %+v\ngot:\t[% x]\nneed:\t[% x]", s, n, b)
 	}
 }
+
+func TestCall(t *testing.T) {
+	c := CallReq{Name: "f", Return: true, Args: []interface{}{int32(1), []byte{0, 1}}}
+	b := []byte{
+		1, 0, 0, 0, 1, 'f',
+		2, 0, 0, 0, 4, 1, 0, 0, 0, 2, 0, 1,
+	}
+	if n := marshal.Write(c); !bytes.Equal(b, n) {
+		t.Errorf("Call not match %+v\ngot:\t[% x]\nneed:\t[% x]", c, n, b)
+	}
+	c = CallReq{Name: "f"}
+	b = []byte{0, 0, 0, 0, 1, 'f', 0, 0, 0, 0}
+	if n := marshal.Write(c); !bytes.Equal(b, n) {
+		t.Errorf("Call not match %+v\ngot:\t[% x]\nneed:\t[% x]", c, n, b)
+	}
+
+	var res []SKey
+	body := []byte{1, 0, 0, 0, 9, 0, 0, 0, 2, 0, 0, 0, 4, 1, 0, 0, 0, 3, 'a', '.', 'b'}
+	if _, total, err := ReadCallResult(&iproto.Response{Code: RcOK, Body: body}, &res); err != nil || total != 1 || res[0].Domain != "a.b" {
+		t.Errorf("Call result %+v %v", res, err)
+	}
+	_, _, err := ReadCallResult(&iproto.Response{Code: RcLuaError, Body: []byte("boom\x00")}, &res)
+	if le, ok := err.(*LuaError); !ok || le.Code != RcLuaError || le.Message != "boom" {
+		t.Errorf("Call error %#v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package sbox
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Field is a named field of space tuple
+type Field struct {
+	Name string
+	No   uint32
+	Type reflect.Type
+}
+
+// Index is a named index of space, Parts are fields in key order
+type Index struct {
+	Name  string
+	No    uint32
+	Parts []*Field
+}
+
+// Space describes a box space stored as Go struct.
+//
+// Schema is declared with sbox struct tags, alongside tail and tailsplit:
+//
+//	type User struct {
+//		Id    uint32 `sbox:"space=3,index=primary"`
+//		Email string `sbox:"name=email,index=email"`
+//		Group uint32 `sbox:"index=group:2"`
+//		Nick  string `sbox:"index=group:2"`
+//	}
+//
+// space=N sets space number (it may be on any field), name=x overrides field name (Go name by default),
+// index=x or index=x:N adds field to index x, number N. Fields of composite index are in struct order.
+// Index without explicit number gets number by order of first appearance, so first index is primary.
+type Space struct {
+	No      uint32
+	Type    reflect.Type
+	Fields  []*Field
+	Indexes []*Index
+}
+
+var schemaL sync.Mutex
+var spacesByNo = make(map[uint32]*Space)
+var spacesByType = make(map[reflect.Type]*Space)
+
+// Register registers struct type of v as space declared by its space tag.
+// It panics if schema is malformed or space number or type is already registered.
+func Register(v interface{}) *Space {
+	s := newSpace(v)
+	if s.No == noSpace {
+		log.Panicf("Struct %+v has no sbox:space tag", s.Type)
+	}
+	return register(s)
+}
+
+// RegisterSpace registers struct type of v as space no, for types without space tag
+func RegisterSpace(no uint32, v interface{}) *Space {
+	s := newSpace(v)
+	if s.No != noSpace && s.No != no {
+		log.Panicf("Struct %+v is tagged as space %d, not %d", s.Type, s.No, no)
+	}
+	s.No = no
+	return register(s)
+}
+
+func register(s *Space) *Space {
+	schemaL.Lock()
+	defer schemaL.Unlock()
+	if _, ok := spacesByNo[s.No]; ok {
+		log.Panicf("Space %d is already registered", s.No)
+	}
+	if _, ok := spacesByType[s.Type]; ok {
+		log.Panicf("Struct %+v is already registered", s.Type)
+	}
+	spacesByNo[s.No] = s
+	spacesByType[s.Type] = s
+	return s
+}
+
+// Unregister removes space no and its struct type from registry, so they could be registered again
+func Unregister(no uint32) {
+	schemaL.Lock()
+	defer schemaL.Unlock()
+	if s, ok := spacesByNo[no]; ok {
+		delete(spacesByNo, no)
+		delete(spacesByType, s.Type)
+	}
+}
+
+// SpaceByNo returns registered space by number, or nil
+func SpaceByNo(no uint32) *Space {
+	schemaL.Lock()
+	defer schemaL.Unlock()
+	return spacesByNo[no]
+}
+
+// SpaceOf returns space registered for type of v, or nil.
+// v may be a struct, pointer to it, slice of them or pointer to slice, so out argument of ReadMany fits.
+func SpaceOf(v interface{}) *Space {
+	rt := reflect.TypeOf(v)
+	for rt != nil && (rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice) {
+		rt = rt.Elem()
+	}
+	schemaL.Lock()
+	defer schemaL.Unlock()
+	return spacesByType[rt]
+}
+
+const noSpace = ^uint32(0)
+
+func newSpace(v interface{}) *Space {
+	rt := reflect.TypeOf(v)
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		log.Panicf("Could register only struct as a space, got %+v", rt)
+	}
+	s := &Space{No: noSpace, Type: rt}
+	/* tuple fields are exactly fields of struct writer, so numbers match written tuples */
+	wr := writer(rt)
+	if wr.err != nil {
+		log.Panic(wr.err)
+	}
+	for i, fw := range wr.Writer.Flds {
+		sf := rt.Field(fw.I)
+		fld := &Field{Name: sf.Name, No: uint32(i), Type: sf.Type}
+		s.Fields = append(s.Fields, fld)
+		for _, m := range strings.Split(fw.Tag.Get("sbox"), ",") {
+			eq := strings.IndexByte(m, '=')
+			if eq < 0 {
+				continue
+			}
+			key, val := m[:eq], m[eq+1:]
+			switch key {
+			case "space":
+				no, err := strconv.ParseUint(val, 10, 32)
+				if err != nil || s.No != noSpace {
+					log.Panicf("Wrong or duplicate sbox:space tag %q in %+v", m, rt)
+				}
+				s.No = uint32(no)
+			case "name":
+				fld.Name = val
+			case "index":
+				s.addIndexPart(val, fld)
+			default:
+				log.Panicf("Unknown sbox tag %q in %+v", m, rt)
+			}
+		}
+	}
+	if wr.Tail != NoTail {
+		last := s.Fields[len(s.Fields)-1]
+		for _, ix := range s.Indexes {
+			for _, p := range ix.Parts {
+				if p == last {
+					log.Panicf("Tail field %s could not be indexed in %+v", last.Name, rt)
+				}
+			}
+		}
+	}
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if names[f.Name] {
+			log.Panicf("Duplicate field name %s in %+v", f.Name, rt)
+		}
+		names[f.Name] = true
+	}
+	nos := make(map[uint32]bool)
+	for _, ix := range s.Indexes {
+		if nos[ix.No] {
+			log.Panicf("Duplicate index number %d in %+v", ix.No, rt)
+		}
+		nos[ix.No] = true
+	}
+	return s
+}
+
+func (s *Space) addIndexPart(val string, fld *Field) {
+	name, no := val, uint32(len(s.Indexes))
+	explicit := false
+	if colon := strings.IndexByte(val, ':'); colon >= 0 {
+		n, err := strconv.ParseUint(val[colon+1:], 10, 32)
+		if err != nil {
+			log.Panicf("Wrong sbox:index tag %q in %+v", val, s.Type)
+		}
+		name, no, explicit = val[:colon], uint32(n), true
+	}
+	for _, ix := range s.Indexes {
+		if ix.Name == name {
+			if explicit && ix.No != no {
+				log.Panicf("Index %s has numbers %d and %d in %+v", name, ix.No, no, s.Type)
+			}
+			ix.Parts = append(ix.Parts, fld)
+			return
+		}
+	}
+	s.Indexes = append(s.Indexes, &Index{Name: name, No: no, Parts: []*Field{fld}})
+}
+
+// Field returns field by name
+func (s *Space) Field(name string) (*Field, error) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("Space %d has no field %q", s.No, name)
+}
+
+// Index returns index by name
+func (s *Space) Index(name string) (*Index, error) {
+	for _, ix := range s.Indexes {
+		if ix.Name == name {
+			return ix, nil
+		}
+	}
+	return nil, fmt.Errorf("Space %d has no index %q", s.No, name)
+}
+
+// Primary returns index number 0
+func (s *Space) Primary() (*Index, error) {
+	for _, ix := range s.Indexes {
+		if ix.No == 0 {
+			return ix, nil
+		}
+	}
+	return nil, fmt.Errorf("Space %d has no primary index", s.No)
+}
+
+/* wireSize is a size of field on the wire, or 0 for variable sized fields */
+func wireSize(rt reflect.Type) int {
+	switch rt.Kind() {
+	case reflect.Int8, reflect.Uint8, reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32, reflect.Int64, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return int(rt.Size())
+	}
+	return 0
+}
+
+func keyPartSize(v interface{}) (int, bool) {
+	if v == nil {
+		return 0, false
+	}
+	rt := reflect.TypeOf(v)
+	switch rt.Kind() {
+	case reflect.String:
+		return 0, true
+	case reflect.Slice:
+		return 0, rt.Elem().Kind() == reflect.Uint8
+	}
+	sz := wireSize(rt)
+	return sz, sz > 0
+}
+
+// ValidateKey checks that key fits index: key is a value of first part, or []interface{}
+// with values of leading parts. Numeric values should have same size as fields.
+func (ix *Index) ValidateKey(key interface{}) error {
+	parts, ok := key.([]interface{})
+	if !ok {
+		parts = []interface{}{key}
+	}
+	if len(parts) == 0 || len(parts) > len(ix.Parts) {
+		return fmt.Errorf("Index %s has %d parts, key has %d", ix.Name, len(ix.Parts), len(parts))
+	}
+	for i, p := range parts {
+		f := ix.Parts[i]
+		sz, ok := keyPartSize(p)
+		if !ok || sz != wireSize(f.Type) {
+			return fmt.Errorf("Key part %T does not match field %s of type %+v", p, f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+// Select builds request for all tuples matching keys in named index. Composite keys are []interface{}.
+func (s *Space) Select(index string, keys ...interface{}) (SelectReq, error) {
+	ix, err := s.Index(index)
+	if err != nil {
+		return SelectReq{}, err
+	}
+	for _, k := range keys {
+		if err = ix.ValidateKey(k); err != nil {
+			return SelectReq{}, err
+		}
+	}
+	return SelectReq{Space: s.No, Index: ix.No, Limit: SelectAll, Keys: keys}, nil
+}
+
+// FieldOp is an update operation on named field
+type FieldOp struct {
+	Field string
+	Op    OpKind
+	Val   interface{}
+}
+
+// Update builds update request of tuple with primary key, resolving field names of ops
+func (s *Space) Update(key interface{}, ret bool, ops ...FieldOp) (UpdateReq, error) {
+	if err := s.validatePrimary(key); err != nil {
+		return UpdateReq{}, err
+	}
+	req := UpdateReq{Space: s.No, Return: ret, Key: key, Ops: make([]Op, len(ops))}
+	for i, op := range ops {
+		f, err := s.Field(op.Field)
+		if err != nil {
+			return UpdateReq{}, err
+		}
+		req.Ops[i] = Op{Field: f.No, Op: op.Op, Val: op.Val}
+	}
+	return req, nil
+}
+
+// Delete builds delete request of tuple with primary key
+func (s *Space) Delete(key interface{}, ret bool) (DeleteReq, error) {
+	if err := s.validatePrimary(key); err != nil {
+		return DeleteReq{}, err
+	}
+	return DeleteReq{Space: s.No, Return: ret, Key: key}, nil
+}
+
+func (s *Space) validatePrimary(key interface{}) error {
+	ix, err := s.Primary()
+	if err != nil {
+		return err
+	}
+	n := 1
+	if parts, ok := key.([]interface{}); ok {
+		n = len(parts)
+	}
+	if n != len(ix.Parts) {
+		return fmt.Errorf("Primary key of space %d has %d parts, key has %d", s.No, len(ix.Parts), n)
+	}
+	return ix.ValidateKey(key)
+}
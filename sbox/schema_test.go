@@ -0,0 +1,121 @@
+package sbox
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+type schemaUser struct {
+	Id    uint32 `sbox:"space=7,index=primary"`
+	Email string `sbox:"name=email,index=email"`
+	Group uint32 `sbox:"index=group:3"`
+	Nick  string `sbox:"index=group:3"`
+	Hits  uint64
+}
+
+func TestSchema(t *testing.T) {
+	sp := Register(schemaUser{})
+	defer Unregister(7)
+	if SpaceByNo(7) != sp || SpaceOf(&[]schemaUser{}) != sp {
+		t.Fatalf("space is not registered")
+	}
+	if ix, err := sp.Index("group"); err != nil || ix.No != 3 || len(ix.Parts) != 2 || ix.Parts[1].Name != "Nick" {
+		t.Errorf("wrong group index %+v %v", ix, err)
+	}
+	if ix, err := sp.Index("email"); err != nil || ix.No != 1 || ix.Parts[0].No != 1 {
+		t.Errorf("wrong email index %+v %v", ix, err)
+	}
+
+	req, err := sp.Select("group", uint32(1), []interface{}{uint32(2), "nick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w marshal.Writer
+	w.Write(req)
+	var e marshal.Writer
+	e.Write(SelectReq{Space: 7, Index: 3, Limit: SelectAll, Keys: []interface{}{}})
+	expect := e.Written()
+	expect[16] = 2
+	expect = append(expect, 1, 0, 0, 0, 4, 1, 0, 0, 0, 2, 0, 0, 0, 4, 2, 0, 0, 0, 4, 'n', 'i', 'c', 'k')
+	if !bytes.Equal(w.Written(), expect) {
+		t.Errorf("select by name\ngot  [% x]\nneed [% x]", w.Written(), expect)
+	}
+
+	if _, err = sp.Select("group", int64(1)); err == nil {
+		t.Errorf("key of wrong size should fail")
+	}
+	if _, err = sp.Select("group", []interface{}{uint32(1), "a", "b"}); err == nil {
+		t.Errorf("key with too many parts should fail")
+	}
+	if _, err = sp.Select("nope", uint32(1)); err == nil {
+		t.Errorf("unknown index should fail")
+	}
+
+	up, err := sp.Update(uint32(5), false, FieldOp{"Hits", OpAdd, uint64(1)}, FieldOp{"email", OpSet, "a@b"})
+	if err != nil || up.Ops[0].Field != 4 || up.Ops[1].Field != 1 {
+		t.Errorf("update by field names %+v %v", up, err)
+	}
+	if _, err = sp.Update(uint32(5), false, FieldOp{"Missing", OpSet, "x"}); err == nil {
+		t.Errorf("unknown field should fail")
+	}
+	if _, err = sp.Delete("5", false); err == nil {
+		t.Errorf("string key for numeric primary should fail")
+	}
+
+	cl := NewClient(iproto.SF(func(r *iproto.Request) {
+		if r.Body[0] != 7 || r.Body[4] != 1 {
+			r.RespondBytes(RcIllegalParams, nil)
+			return
+		}
+		r.RespondBytes(RcOK, []byte{0, 0, 0, 0})
+	}))
+	var users []schemaUser
+	if err = cl.SelectIndex(context.Background(), "email", &users, "a@b"); err != nil {
+		t.Errorf("select index failed %v", err)
+	}
+	var other []SStruct
+	if err = cl.SelectIndex(context.Background(), "email", &other, "a@b"); err == nil {
+		t.Errorf("select of unregistered type should fail")
+	}
+}
+
+func TestSchemaPanics(t *testing.T) {
+	type noSpaceTag struct {
+		Id uint32 `sbox:"index=primary"`
+	}
+	type badTag struct {
+		Id uint32 `sbox:"space=8,unique=1"`
+	}
+	type dupIndex struct {
+		Id   uint32 `sbox:"space=9,index=a:0"`
+		Name string `sbox:"index=b:0"`
+	}
+	for _, v := range []interface{}{noSpaceTag{}, badTag{}, dupIndex{}, uint32(1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("register of %T should panic", v)
+				}
+			}()
+			Register(v)
+		}()
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	type untagged struct{ Id uint32 }
+	for i := 0; i < 2; i++ {
+		sp := RegisterSpace(8, untagged{})
+		if SpaceByNo(8) != sp || SpaceOf(untagged{}) != sp {
+			t.Fatalf("space is not registered")
+		}
+		Unregister(8)
+		if SpaceByNo(8) != nil || SpaceOf(untagged{}) != nil {
+			t.Fatalf("space is not unregistered")
+		}
+	}
+}
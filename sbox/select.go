@@ -27,7 +27,13 @@ func (s SelectReq) IWrite(w *marshal.Writer) {
 	w.Uint32(s.Space)
 	w.Uint32(s.Index)
 	w.Uint32(s.Offset)
-	cnt := CountKeys(s.Keys)
+	cnt, err := CountKeys(s.Keys)
+	if err != nil {
+		if w.Err == nil {
+			w.Err = err
+		}
+		return
+	}
 	if s.Limit >= 0 {
 		w.Int32(s.Limit)
 	} else if s.Limit == SelectN {
@@ -43,34 +49,38 @@ func (s SelectReq) IMsg() iproto.RequestType {
 	return 17
 }
 
-func CountKeys(keys interface{}) int {
+// CountKeys returns number of tuples WriteKeys writes for keys
+func CountKeys(keys interface{}) (int, error) {
 	switch k := keys.(type) {
 	case int8, uint8, int16, uint16, int32, uint32, int64, uint64, []byte, string:
-		return 1
+		return 1, nil
 	case []uint32:
-		return len(k)
+		return len(k), nil
 	case []int32:
-		return len(k)
+		return len(k), nil
 	case []uint64:
-		return len(k)
+		return len(k), nil
 	case []int64:
-		return len(k)
+		return len(k), nil
 	case []float32:
-		return len(k)
+		return len(k), nil
 	case []float64:
-		return len(k)
+		return len(k), nil
 	case []string:
-		return len(k)
+		return len(k), nil
 	case [][]byte:
-		return len(k)
+		return len(k), nil
 	case [][][]byte:
-		return len(k)
+		return len(k), nil
 	case []interface{}:
+		/* WriteKeys writes each element as one tuple */
 		sum := 0
 		for _, v := range k {
-			sum += CountKeys(v)
+			if v != nil {
+				sum++
+			}
 		}
-		return sum
+		return sum, nil
 	default:
 		v := reflect.ValueOf(k)
 		if v.Kind() == reflect.Ptr {
@@ -80,22 +90,22 @@ func CountKeys(keys interface{}) int {
 	}
 }
 
-func CountKeysValues(v reflect.Value) int {
+func CountKeysValues(v reflect.Value) (int, error) {
 	switch v.Kind() {
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Float32, reflect.Float64,
 		reflect.Struct, reflect.String:
-		return 1
+		return 1, nil
 	case reflect.Array, reflect.Slice:
-		if v.Kind() == reflect.Uint8 {
-			return 1
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return 1, nil
 		}
-		return v.Len()
-	default:
-		log.Panicf("Don't know how to use value %+v as select keys", v)
+		return v.Len(), nil
+	case reflect.Invalid:
+		return 0, &marshal.UnsupportedTypeError{Reason: "nil could not be used as select keys"}
 	}
-	return 0
+	return 0, &marshal.UnsupportedTypeError{Type: v.Type(), Reason: "could not be used as select keys"}
 }
 
 func WriteKeys(w *marshal.Writer, keys interface{}) {
@@ -161,7 +171,7 @@ func WriteKeysValues(w *marshal.Writer, v reflect.Value) {
 		wr.Write(w, v)
 	case reflect.Array, reflect.Slice:
 		l := v.Len()
-		switch v.Kind() {
+		switch v.Type().Elem().Kind() {
 		case reflect.Uint8:
 			wr := writer(v.Type())
 			wr.Write(w, v)
@@ -0,0 +1,286 @@
+package sbox
+
+import (
+	"encoding/binary"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// Sharder maps shard key to shard number
+type Sharder interface {
+	Shard(key []byte) int
+}
+
+func hash32(b []byte) uint32 {
+	/* FNV-1a with murmur3 finalizer, so close keys are spread well */
+	h := uint32(2166136261)
+	for _, c := range b {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// Modulo picks shard as hash of key modulo number of shards, it should be positive
+type Modulo int
+
+func (m Modulo) Shard(key []byte) int {
+	return int(hash32(key) % uint32(m))
+}
+
+const DefaultRingReplicas = 160
+
+// Ring is a consistent hash ring: adding or removing a shard moves only keys of that shard.
+// Shards are identified by names, so ring is stable as long as names are stable.
+type Ring struct {
+	points []uint32
+	shards []int
+}
+
+// NewRing builds ring with replicas points per shard (DefaultRingReplicas if replicas <= 0).
+// Shard(key) returns index in names.
+func NewRing(names []string, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultRingReplicas
+	}
+	type point struct {
+		h     uint32
+		shard int
+	}
+	points := make([]point, 0, len(names)*replicas)
+	for i, name := range names {
+		for j := 0; j < replicas; j++ {
+			points = append(points, point{hash32([]byte(name + "#" + strconv.Itoa(j))), i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].h < points[j].h })
+	r := &Ring{points: make([]uint32, len(points)), shards: make([]int, len(points))}
+	for i, p := range points {
+		r.points[i], r.shards[i] = p.h, p.shard
+	}
+	return r
+}
+
+func (r *Ring) Shard(key []byte) int {
+	h := hash32(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[i]
+}
+
+// ShardedService routes box requests to Shards by shard key.
+//
+// By default key is a first field of key tuple of select, update and delete,
+// or of inserted tuple of store, and requests without key (like call) are answered with RcIllegalParams.
+// Select with keys on different shards is split per shard, and results are merged:
+// tuples are ordered by shard, not by key, and Limit is applied to merged result.
+// Such select should have zero Offset.
+//
+// If Key is set, it is used for all requests, and selects are not split.
+// Without Shards every request is answered with RcIOError.
+type ShardedService struct {
+	Shards []iproto.Service
+	// Sharder is Modulo(len(Shards)) if nil
+	Sharder Sharder
+	Key     func(r *iproto.Request) (key []byte, ok bool)
+}
+
+// NewShardedService checks that there is at least one shard
+func NewShardedService(shards []iproto.Service, sharder Sharder) *ShardedService {
+	if len(shards) == 0 {
+		log.Panicf("ShardedService needs at least one shard")
+	}
+	return &ShardedService{Shards: shards, Sharder: sharder}
+}
+
+func (s *ShardedService) DefaultTimeout() time.Duration {
+	return 0
+}
+
+func (s *ShardedService) Runned() bool {
+	for _, sh := range s.Shards {
+		if !sh.Runned() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ShardedService) shard(key []byte) int {
+	if s.Sharder == nil {
+		return Modulo(len(s.Shards)).Shard(key)
+	}
+	return s.Sharder.Shard(key)
+}
+
+func (s *ShardedService) Send(r *iproto.Request) {
+	if len(s.Shards) == 0 {
+		r.IOError()
+		return
+	}
+	var key []byte
+	ok := false
+	switch {
+	case s.Key != nil:
+		key, ok = s.Key(r)
+	case r.Msg == SelectReq{}.IMsg():
+		s.sendSelect(r)
+		return
+	case r.Msg == StoreReq{}.IMsg() || r.Msg == UpdateReq{}.IMsg() || r.Msg == DeleteReq{}.IMsg():
+		rd := marshal.Reader{Body: r.Body}
+		rd.Slice(8) /* space and flags */
+		key, ok = firstField(&rd)
+	}
+	if !ok {
+		r.RespondFail(RcIllegalParams)
+		return
+	}
+	s.Shards[s.shard(key)].Send(r)
+}
+
+func firstField(rd *marshal.Reader) ([]byte, bool) {
+	if rd.IntUint32() < 1 {
+		return nil, false
+	}
+	sz := rd.Intvar()
+	if rd.Err != nil || sz < 0 {
+		return nil, false
+	}
+	key := rd.Slice(sz)
+	return key, rd.Err == nil
+}
+
+/* skipTuple returns raw tuple and its first field */
+func skipTuple(rd *marshal.Reader) (raw, key []byte, ok bool) {
+	body := rd.Body
+	cnt := rd.IntUint32()
+	if cnt < 1 || cnt > len(rd.Body) {
+		return nil, nil, false
+	}
+	for i := 0; i < cnt && rd.Err == nil; i++ {
+		sz := rd.Intvar()
+		if sz < 0 {
+			return nil, nil, false
+		}
+		if f := rd.Slice(sz); i == 0 {
+			key = f
+		}
+	}
+	if rd.Err != nil {
+		return nil, nil, false
+	}
+	return body[:len(body)-len(rd.Body)], key, true
+}
+
+const selectHeader = 16
+
+type shardKeys struct {
+	shard int
+	keys  [][]byte
+}
+
+func (s *ShardedService) sendSelect(r *iproto.Request) {
+	if len(r.Body) < selectHeader+4 {
+		r.RespondFail(RcIllegalParams)
+		return
+	}
+	rd := marshal.Reader{Body: r.Body[selectHeader:]}
+	cnt := rd.IntUint32()
+	if cnt < 1 || cnt > len(rd.Body) {
+		r.RespondFail(RcIllegalParams)
+		return
+	}
+	var groups []shardKeys
+	for i := 0; i < cnt; i++ {
+		raw, key, ok := skipTuple(&rd)
+		if !ok {
+			r.RespondFail(RcIllegalParams)
+			return
+		}
+		shard := s.shard(key)
+		j := 0
+		for j < len(groups) && groups[j].shard != shard {
+			j++
+		}
+		if j == len(groups) {
+			groups = append(groups, shardKeys{shard: shard})
+		}
+		groups[j].keys = append(groups[j].keys, raw)
+	}
+	if len(groups) == 1 {
+		s.Shards[groups[0].shard].Send(r)
+		return
+	}
+	if binary.LittleEndian.Uint32(r.Body[8:]) != 0 {
+		/* offset could not be applied to merged result */
+		r.RespondFail(RcIllegalParams)
+		return
+	}
+
+	if !r.SetPending() {
+		return
+	}
+	ctx := r.Context()
+	if ctx == nil {
+		return
+	}
+	multi := ctx.NewMulti()
+	for _, g := range groups {
+		var w marshal.Writer
+		w.Bytes(r.Body[:selectHeader])
+		w.IntUint32(len(g.keys))
+		for _, k := range g.keys {
+			w.Bytes(k)
+		}
+		multi.SendMsgBody(s.Shards[g.shard], r.Msg, iproto.Body(w.Written()))
+	}
+	limit := int(int32(binary.LittleEndian.Uint32(r.Body[12:])))
+	go func() {
+		defer ctx.Done()
+		r.RespondBytes(mergeSelect(multi.Results(), limit))
+	}()
+}
+
+func mergeSelect(res iproto.MultiResponse, limit int) (iproto.RetCode, []byte) {
+	if limit < 0 {
+		limit = int(^uint(0) >> 1)
+	}
+	var w marshal.Writer
+	w.Uint32(0)
+	n := 0
+	for _, r := range res.Sort() {
+		if r.Code != iproto.RcOK {
+			return r.Code, r.Body
+		}
+		rd := marshal.Reader{Body: r.Body}
+		cnt := rd.IntUint32()
+		for i := 0; i < cnt && n < limit && rd.Err == nil; i++ {
+			sz := rd.IntUint32()
+			if sz < 0 {
+				return iproto.RcProtocolError, nil
+			}
+			t := rd.Slice(sz + 4)
+			w.IntUint32(sz)
+			w.Bytes(t)
+			n++
+		}
+		if rd.Err != nil {
+			return iproto.RcProtocolError, nil
+		}
+	}
+	body := w.Written()
+	binary.LittleEndian.PutUint32(body, uint32(n))
+	return iproto.RcOK, body
+}
@@ -0,0 +1,167 @@
+package sbox
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/funny-falcon/go-iproto"
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+/* fakeShard records requests and answers select with key tuples, other requests with one tuple */
+type fakeShard struct {
+	m    sync.Mutex
+	reqs []iproto.RequestType
+	keys int
+}
+
+func (f *fakeShard) Service() iproto.Service {
+	return iproto.SF(func(r *iproto.Request) {
+		f.m.Lock()
+		f.reqs = append(f.reqs, r.Msg)
+		f.m.Unlock()
+		if r.Msg != 17 {
+			r.RespondBytes(RcOK, []byte{1, 0, 0, 0})
+			return
+		}
+		rd := marshal.Reader{Body: r.Body[selectHeader:]}
+		cnt := rd.IntUint32()
+		var w marshal.Writer
+		w.IntUint32(cnt)
+		for i := 0; i < cnt; i++ {
+			raw, _, _ := skipTuple(&rd)
+			w.IntUint32(len(raw) - 4)
+			w.Bytes(raw)
+		}
+		f.m.Lock()
+		f.keys += cnt
+		f.m.Unlock()
+		r.RespondBytes(RcOK, w.Written())
+	})
+}
+
+func key(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, i)
+	return b
+}
+
+func TestRing(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	r4 := NewRing(names, 0)
+	r5 := NewRing(append(names, "e"), 0)
+	counts := make([]int, 5)
+	moved := 0
+	for i := uint32(0); i < 10000; i++ {
+		s4, s5 := r4.Shard(key(i)), r5.Shard(key(i))
+		counts[s5]++
+		if s4 != s5 {
+			if s5 != 4 {
+				t.Fatalf("key %d moved between old shards %d -> %d", i, s4, s5)
+			}
+			moved++
+		}
+	}
+	if moved < 1000 || moved > 3000 {
+		t.Errorf("new shard took %d of 10000 keys", moved)
+	}
+	for i, c := range counts {
+		if c < 1000 || c > 3000 {
+			t.Errorf("shard %d got %d of 10000 keys", i, c)
+		}
+	}
+}
+
+func TestShardedRoute(t *testing.T) {
+	shards := make([]*fakeShard, 3)
+	services := make([]iproto.Service, len(shards))
+	for i := range shards {
+		shards[i] = &fakeShard{}
+		services[i] = shards[i].Service()
+	}
+	s := NewShardedService(services, nil)
+	for i := uint32(0); i < 30; i++ {
+		res := iproto.Call(s, UpdateReq{Space: 1, Key: i, Ops: []Op{{Field: 1, Op: OpAdd, Val: uint32(1)}}})
+		if res.Code != RcOK {
+			t.Fatalf("update answered with %x", res.Code)
+		}
+		iproto.Call(s, StoreReq{Space: 1, Tuple: []interface{}{i, "x"}})
+		iproto.Call(s, DeleteReq{Space: 1, Key: i})
+	}
+	for i, sh := range shards {
+		if len(sh.reqs) == 0 || len(sh.reqs)%3 != 0 {
+			t.Errorf("shard %d got %d requests", i, len(sh.reqs))
+		}
+	}
+	if res := iproto.Call(s, RPCReq{Name: "f"}); res.Code != RcIllegalParams {
+		t.Errorf("call without key answered with %x", res.Code)
+	}
+}
+
+func TestShardedEmpty(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewShardedService should panic without shards")
+		}
+	}()
+	if res := iproto.Call(&ShardedService{}, DeleteReq{Space: 1, Key: 1}); res.Code != iproto.RcIOError {
+		t.Errorf("service without shards answered with %x", res.Code)
+	}
+	NewShardedService(nil, nil)
+}
+
+func TestShardedSelect(t *testing.T) {
+	shards := make([]*fakeShard, 3)
+	names := make([]string, 3)
+	s := &ShardedService{}
+	for i := range shards {
+		shards[i] = &fakeShard{}
+		names[i] = "shard" + strconv.Itoa(i)
+		s.Shards = append(s.Shards, shards[i].Service())
+	}
+	s.Sharder = NewRing(names, 0)
+
+	keys := []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	res := iproto.Call(s, SelectReq{Space: 1, Limit: SelectAll, Keys: keys})
+	var got []uint32
+	if _, _, err := ReadMany(res.Body, &got); res.Code != RcOK || err != nil {
+		t.Fatalf("select answered %x %v", res.Code, err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("merged %d tuples, expected %d", len(got), len(keys))
+	}
+	seen := make(map[uint32]bool)
+	for _, k := range got {
+		seen[k] = true
+	}
+	for _, k := range keys {
+		if !seen[k] {
+			t.Errorf("key %d lost", k)
+		}
+	}
+	for i, sh := range shards {
+		if sh.keys == 0 {
+			t.Errorf("shard %d got no keys", i)
+		}
+	}
+
+	res = iproto.Call(s, SelectReq{Space: 1, Limit: 3, Keys: keys})
+	if _, total, err := ReadMany(res.Body, &got); err != nil || total != 3 {
+		t.Errorf("limited select returned %d tuples %v", total, err)
+	}
+	if res = iproto.Call(s, SelectReq{Space: 1, Offset: 1, Limit: 3, Keys: keys}); res.Code != RcIllegalParams {
+		t.Errorf("split select with offset answered %x", res.Code)
+	}
+
+	/* key function disables split */
+	s.Key = func(r *iproto.Request) ([]byte, bool) { return []byte("same"), true }
+	sh := shards[s.Sharder.Shard([]byte("same"))]
+	n := len(sh.reqs)
+	iproto.Call(s, SelectReq{Space: 1, Limit: SelectAll, Keys: keys})
+	iproto.Call(s, RPCReq{Name: "f"})
+	if len(sh.reqs) != n+2 {
+		t.Errorf("key function should route all requests to one shard")
+	}
+}
@@ -2,6 +2,7 @@ package sbox
 
 import (
 	"bytes"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -22,6 +23,24 @@ type SStruct struct {
 
 type burbur int32
 
+/* unexported field shifts index of the tail field */
+type STail struct {
+	I uint32
+	x int
+	T []uint16 `sbox:"tail"`
+}
+
+type SPair struct {
+	A uint32
+	B uint8
+}
+
+type STailSplit struct {
+	I uint32
+	x int
+	P []SPair `sbox:"tailsplit"`
+}
+
 var shoulds = []Should{
 	{"asdf", []byte{1, 0, 0, 0, 4, 'a', 's', 'd', 'f'}},
 	{[]byte("asdf"), []byte{1, 0, 0, 0, 4, 'a', 's', 'd', 'f'}},
@@ -31,6 +50,10 @@ var shoulds = []Should{
 	{&[]int32{0x3def, 0xff00}, []byte{2, 0, 0, 0, 4, 0xef, 0x3d, 0, 0, 4, 0, 0xff, 0, 0}},
 	{SStruct{0x3def, 0xfe, []byte{1, 2, 3}, "abcd"},
 		[]byte{4, 0, 0, 0, 4, 0xef, 0x3d, 0, 0, 1, 0xfe, 3, 1, 2, 3, 4, 'a', 'b', 'c', 'd'}},
+	{STail{1, 0, []uint16{2, 3}},
+		[]byte{3, 0, 0, 0, 4, 1, 0, 0, 0, 2, 2, 0, 2, 3, 0}},
+	{STailSplit{1, 0, []SPair{{2, 3}, {4, 5}}},
+		[]byte{5, 0, 0, 0, 4, 1, 0, 0, 0, 4, 2, 0, 0, 0, 1, 3, 4, 4, 0, 0, 0, 1, 5}},
 }
 
 var wr = &marshal.Writer{}
@@ -115,3 +138,26 @@ func TestReadGeneral(t *testing.T) {
 		t.Errorf("Expected 0xfeff 0xfeff0000, got 0x%x 0x%x", i, j)
 	}
 }
+
+type badTail struct {
+	T []uint32 `sbox:"tail"`
+	I uint32
+}
+
+func TestTupleErrors(t *testing.T) {
+	var bt *marshal.BadTagError
+	if err := read(new(badTail), []byte{1, 0, 0, 0, 4, 1, 0, 0, 0}); !errors.As(err, &bt) {
+		t.Errorf("tail not at the end: %v", err)
+	}
+	var ut *marshal.UnsupportedTypeError
+	if err := read(new(map[int]int), []byte{0, 0, 0, 0}); !errors.As(err, &ut) {
+		t.Errorf("map as tuple: %v", err)
+	}
+	if _, err := marshal.TryWrite(SelectReq{Keys: map[int]int{}}); !errors.As(err, &ut) {
+		t.Errorf("map as select keys: %v", err)
+	}
+	var sb *marshal.ShortBodyError
+	if err := read(new([]int32), []byte{0xff, 0xff, 0xff, 0x7f}); !errors.As(err, &sb) {
+		t.Errorf("huge cardinality: %v", err)
+	}
+}
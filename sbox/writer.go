@@ -3,7 +3,6 @@ package sbox
 import (
 	"log"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/funny-falcon/go-iproto/marshal"
@@ -11,6 +10,11 @@ import (
 
 var _ = log.Print
 
+// TupleWriter is implemented by types with generated tuple encoder (cmd/iprotogen -sbox)
+type TupleWriter interface {
+	IWriteTuple(w *marshal.Writer)
+}
+
 func WriteTuple(w *marshal.Writer, i interface{}) {
 	switch o := i.(type) {
 	case nil:
@@ -68,6 +72,8 @@ func WriteTuple(w *marshal.Writer, i interface{}) {
 		for _, v := range o {
 			w.WriteWithSize(v, (*marshal.Writer).Intvar)
 		}
+	case TupleWriter:
+		o.IWriteTuple(w)
 	default:
 		val := reflect.ValueOf(i)
 		rt := val.Type()
@@ -77,6 +83,8 @@ func WriteTuple(w *marshal.Writer, i interface{}) {
 	return
 }
 
+var tupleWriter = reflect.TypeOf(new(TupleWriter)).Elem()
+
 var ws = make(map[uintptr]*TWriter)
 var wss = ws
 var wsL sync.Mutex
@@ -112,6 +120,7 @@ type TWriter struct {
 	Writer *marshal.TWriter
 	Write  func(*marshal.Writer, reflect.Value)
 	Tail   TailType
+	err    error
 }
 
 func (t *TWriter) Fill() {
@@ -147,6 +156,11 @@ func (t *TWriter) Fill() {
 		}
 	case reflect.Struct:
 		t.FillStruct()
+		if rt.Implements(tupleWriter) {
+			t.Write = func(w *marshal.Writer, v reflect.Value) {
+				v.Interface().(TupleWriter).IWriteTuple(w)
+			}
+		}
 	case reflect.Interface:
 		t.Write = func(w *marshal.Writer, v reflect.Value) {
 			el := v.Elem()
@@ -161,11 +175,20 @@ func (t *TWriter) Fill() {
 			t.Writer.WithSize(w, v, (*marshal.Writer).Intvar)
 		}
 	default:
-		log.Panicf("Don't know how to write type %+v as a tuple", rt)
+		t.fail(&marshal.UnsupportedTypeError{Type: rt, Reason: "could not be written as a tuple"})
 	}
 	return
 }
 
+func (t *TWriter) fail(err error) {
+	t.err = err
+	t.Write = func(w *marshal.Writer, v reflect.Value) {
+		if w.Err == nil {
+			w.Err = err
+		}
+	}
+}
+
 func (sw *TWriter) structCnt(v reflect.Value) int {
 	flds := sw.Writer.Flds
 	switch sw.Tail {
@@ -175,7 +198,7 @@ func (sw *TWriter) structCnt(v reflect.Value) int {
 		return len(flds) - 1 + v.Field(flds[len(flds)-1].I).Len()
 	case TailSplit:
 		last := flds[len(flds)-1]
-		return len(flds) - 1 + v.Field(last.I).Len()*len(last.TWriter.Flds)
+		return len(flds) - 1 + v.Field(last.I).Len()*len(last.Elem.Flds)
 	}
 	return 0
 }
@@ -195,51 +218,38 @@ func (sw *TWriter) structWriter(w *marshal.Writer, v reflect.Value) {
 	case NoTail:
 	case Tail:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
 		for i := 0; i < l; i++ {
 			val := fv.Index(i)
-			fs.WithSize(w, val, (*marshal.Writer).Intvar)
+			fs.Elem.WithSize(w, val, (*marshal.Writer).Intvar)
 		}
 	case TailSplit:
 		fs := &flds[n]
-		fv := v.Field(n)
+		fv := v.Field(fs.I)
 		l := fv.Len()
-		fss := fs.TWriter.Flds
+		fss := fs.Elem.Flds
 		fl := len(fss)
 		for i := 0; i < l; i++ {
 			str := fv.Index(i)
 			for j := 0; j < fl; j++ {
-				fss[i].WithSize(w, str.Field(i), (*marshal.Writer).Intvar)
+				fss[j].WithSize(w, str.Field(fss[j].I), (*marshal.Writer).Intvar)
 			}
 		}
 	}
 }
 
 func (t *TWriter) FillStruct() {
+	if err := t.Writer.Err; err != nil {
+		t.fail(err)
+		return
+	}
 	t.Write = t.structWriter
 	for i := range t.Writer.Flds {
 		fld := &t.Writer.Flds[i]
-		ipro := fld.Tag.Get("sbox")
-
-		for _, m := range strings.Split(ipro, ",") {
-			if t.Tail != NoTail {
-				log.Panicf("Sbox Tail could be only last field in a struct %+v", t.Writer.Type)
-			}
-			if m == "tail" {
-				if fld.Type.Kind() != reflect.Slice {
-					log.Panicf("Could apply sbox:tail only for slices")
-				}
-				t.Tail = Tail
-			} else if m == "tailsplit" {
-				if fld.Type.Kind() != reflect.Slice {
-					log.Panicf("Could apply sbox:tailsplit only for slices")
-				}
-				if fld.Type.Elem().Kind() != reflect.Struct {
-					log.Panicf("Could apply sbox:tailsplit only for slices of struct")
-				}
-				t.Tail = TailSplit
-			}
+		if reason := t.Tail.apply(fld.Type, fld.Tag.Get("sbox")); reason != "" {
+			t.fail(badTag(t.Writer.Type, fld.I, reason))
+			return
 		}
 	}
 }
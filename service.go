@@ -2,6 +2,7 @@ package iproto
 
 import (
 	"log"
+	"sync/atomic"
 	"time"
 )
 
@@ -66,7 +67,7 @@ type PointLoop interface {
 type SimplePoint struct {
 	b          Buffer
 	exit       chan bool
-	stopped    bool
+	stopped    uint32
 	standalone bool
 	PointLoop
 	Timeout     time.Duration
@@ -104,6 +105,15 @@ func (s *SimplePoint) ReceiveChan() <-chan *Request {
 	return s.b.ch
 }
 
+// QueueLen returns number of requests waiting to be taken by end point.
+// Child end points share channel with parent, so they report parent's channel length
+func (s *SimplePoint) QueueLen() int {
+	if s.standalone {
+		return s.b.Len()
+	}
+	return len(s.b.ch)
+}
+
 func (s *SimplePoint) RunChild(p EndPoint) {
 	if p.Runned() {
 		log.Panicf("EndPoint already runned ( %v )", s)
@@ -151,10 +161,10 @@ func (s *SimplePoint) Stop() {
 	if s.standalone {
 		s.b.close()
 	}
-	s.stopped = true
+	atomic.StoreUint32(&s.stopped, 1)
 	s.exit <- true
 }
 
 func (s *SimplePoint) Stopped() bool {
-	return s.stopped
+	return atomic.LoadUint32(&s.stopped) != 0
 }
@@ -0,0 +1,169 @@
+package iproto
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/funny-falcon/go-iproto/marshal"
+)
+
+// FromContext returns Context which is canceled when ctx is canceled, and expired when ctx deadline is exceeded.
+// Returned function should be called when Context is not needed anymore: it stops watching ctx
+// and calls Context.Done. Context is never canceled by ctx after it returns.
+func FromContext(ctx context.Context) (cx *Context, release func()) {
+	cx = &Context{}
+	if dl, ok := ctx.Deadline(); ok {
+		cx.SetDeadline(NewEpoch(dl))
+	}
+	done := ctx.Done()
+	if done == nil {
+		return cx, cx.Done
+	}
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-done:
+			/* select picks randomly, so check that release was not called */
+			select {
+			case <-stop:
+			default:
+				failContext(ctx, cx)
+			}
+		case <-stop:
+		}
+	}()
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			close(stop)
+			<-exited
+			cx.Done()
+		})
+	}
+	return cx, release
+}
+
+func failContext(ctx context.Context, cx interface {
+	Cancel()
+	Expire()
+}) {
+	if ctx.Err() == context.DeadlineExceeded {
+		cx.Expire()
+	} else {
+		cx.Cancel()
+	}
+}
+
+// StdContext returns context.Context derived from parent, which is done when Context is canceled or expired.
+// Err of returned context is context.DeadlineExceeded if Context were expired.
+// Deadline of returned context is the earliest of parent's and Context's deadlines.
+// Returned cancel function should be called when returned context is not needed anymore.
+func (c *Context) StdContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sc := &stdContext{Context: ctx, cx: c, cancel: cancel}
+	c.AddCanceler(sc)
+	return sc, func() {
+		c.RemoveCanceler(sc)
+		cancel()
+	}
+}
+
+type stdContext struct {
+	context.Context
+	cx      *Context
+	cancel  context.CancelFunc
+	expired uint32
+}
+
+func (sc *stdContext) Cancel() {
+	if CxState(atomic.LoadUint32((*uint32)(&sc.cx.State))) == CxTimeout {
+		atomic.StoreUint32(&sc.expired, 1)
+	}
+	sc.cancel()
+	sc.cx.RemoveCanceler(sc)
+}
+
+func (sc *stdContext) Deadline() (time.Time, bool) {
+	pdl, ok := sc.Context.Deadline()
+	if dl := sc.cx.Deadline(); !dl.Zero() && (!ok || dl.Time().Before(pdl)) {
+		return dl.Time(), true
+	}
+	return pdl, ok
+}
+
+func (sc *stdContext) Err() error {
+	err := sc.Context.Err()
+	if err == context.Canceled && atomic.LoadUint32(&sc.expired) != 0 {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+type stdContextBookmark struct {
+	Bookmark
+	stop chan struct{}
+}
+
+func (sb *stdContextBookmark) Respond(res *Response) {
+	close(sb.stop)
+}
+
+// SendReqCtx sends request to service, setting request timeout to ctx deadline.
+// Request is canceled (or expired, if ctx deadline exceeded) when ctx is done before response arrives.
+func SendReqCtx(ctx context.Context, serv Service, r *Request) {
+	if ctx.Err() != nil {
+		failContext(ctx, r)
+		return
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		timeout := time.Until(dl)
+		if timeout <= 0 {
+			r.Expire()
+			return
+		}
+		r.SetTimeout(timeout)
+	}
+	if done := ctx.Done(); done != nil {
+		sb := &stdContextBookmark{stop: make(chan struct{})}
+		if !r.ChainBookmark(sb) {
+			return
+		}
+		go func() {
+			select {
+			case <-done:
+				failContext(ctx, r)
+			case <-sb.stop:
+			}
+		}()
+	}
+	serv.Send(r)
+}
+
+func SendMsgBodyCtx(ctx context.Context, serv Service, m RequestType, r interface{}) (*Request, Chan) {
+	var body []byte
+	var ok bool
+	if body, ok = r.(Body); !ok {
+		body = marshal.Write(r)
+	}
+	res := make(Chan, 1)
+	req := &Request{Msg: m, Body: body, Responder: res}
+	SendReqCtx(ctx, serv, req)
+	return req, res
+}
+
+func SendCtx(ctx context.Context, serv Service, r RequestData) (*Request, Chan) {
+	return SendMsgBodyCtx(ctx, serv, r.IMsg(), r)
+}
+
+func CallMsgBodyCtx(ctx context.Context, serv Service, m RequestType, r interface{}) *Response {
+	_, res := SendMsgBodyCtx(ctx, serv, m, r)
+	return <-res
+}
+
+func CallCtx(ctx context.Context, serv Service, r RequestData) *Response {
+	return CallMsgBodyCtx(ctx, serv, r.IMsg(), r)
+}
@@ -0,0 +1,127 @@
+package iproto
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitCxState(t *testing.T, cx *Context, st CxState) {
+	for i := 0; CxState(atomic.LoadUint32((*uint32)(&cx.State))) != st; i++ {
+		if i == 100 {
+			t.Fatalf("context state is %d, want %d", cx.State, st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cx, release := FromContext(ctx)
+	defer release()
+	if !cx.Deadline().Zero() {
+		t.Errorf("context without deadline gives %v", cx.Deadline())
+	}
+	cancel()
+	waitCxState(t, cx, CxCanceled)
+
+	dl := time.Now().Add(10 * time.Millisecond)
+	ctx, cancel = context.WithDeadline(context.Background(), dl)
+	defer cancel()
+	cx, release = FromContext(ctx)
+	defer release()
+	if cx.Deadline() != NewEpoch(dl) {
+		t.Errorf("deadline %v, want %v", cx.Deadline().Time(), dl)
+	}
+	waitCxState(t, cx, CxTimeout)
+
+	/* released context is not watched anymore */
+	ctx, cancel = context.WithCancel(context.Background())
+	cx, release = FromContext(ctx)
+	release()
+	cancel()
+	time.Sleep(5 * time.Millisecond)
+	if !cx.Alive() {
+		t.Errorf("released context is canceled")
+	}
+}
+
+func TestStdContext(t *testing.T) {
+	var cx Context
+	ctx, cancel := cx.StdContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("context without deadline has one")
+	}
+	cx.Cancel()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("canceled context gives %v", ctx.Err())
+	}
+
+	cx = Context{}
+	dl := time.Now().Add(time.Second)
+	cx.SetDeadline(NewEpoch(dl))
+	parent, pcancel := context.WithTimeout(context.Background(), time.Hour)
+	defer pcancel()
+	ctx, cancel = cx.StdContext(parent)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(NewEpoch(dl).Time()) {
+		t.Errorf("deadline %v, want earliest %v", d, dl)
+	}
+	cx.Expire()
+	<-ctx.Done()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("expired context gives %v", ctx.Err())
+	}
+
+	/* parent's cancel goes to std context, but not to Context */
+	cx = Context{}
+	parent, pcancel = context.WithCancel(context.Background())
+	ctx, cancel = cx.StdContext(parent)
+	defer cancel()
+	pcancel()
+	<-ctx.Done()
+	if !cx.Alive() {
+		t.Errorf("parent's cancel reached Context")
+	}
+}
+
+func TestCallCtx(t *testing.T) {
+	held := make(chan *Request, 1)
+	serv := holdService(held)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, res := SendMsgBodyCtx(ctx, serv, 1, Body(nil))
+	<-held
+	cancel()
+	if r := <-res; r.Code != RcCanceled {
+		t.Errorf("canceled request answered with %x", r.Code)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, res = SendMsgBodyCtx(ctx, serv, 1, Body(nil))
+	req := <-held
+	if dl := req.Deadline(); dl.Zero() || dl.Remains() > 10*time.Millisecond {
+		t.Errorf("request deadline is not taken from context: %v", dl.Remains())
+	}
+	if r := <-res; r.Code != RcTimeout {
+		t.Errorf("expired request answered with %x", r.Code)
+	}
+
+	/* done context does not reach service */
+	if r := CallMsgBodyCtx(ctx, serv, 1, Body(nil)); r.Code != RcTimeout || len(held) != 0 {
+		t.Errorf("request with expired context answered with %x", r.Code)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if r := CallMsgBodyCtx(ctx, serv, 1, Body(nil)); r.Code != RcCanceled || len(held) != 0 {
+		t.Errorf("request with canceled context answered with %x", r.Code)
+	}
+
+	if r := CallMsgBodyCtx(context.Background(), answerService("a"), 1, Body(nil)); r.Code != RcOK || string(r.Body) != "a" {
+		t.Errorf("answered %x %q", r.Code, r.Body)
+	}
+}
@@ -58,6 +58,7 @@ type MultiRequest struct {
 	w         sync.Cond
 	timer     Timer
 	timerSet  bool
+	deadline  Epoch
 	owngen    bool
 	kind      uint32
 	bodyn     uint32
@@ -71,9 +72,19 @@ func (w *MultiRequest) TimeoutFrom(d Service) {
 	w.SetTimeout(d.DefaultTimeout())
 }
 
+// SetTimeout arms timer for all requests. If timer is already set, earliest deadline wins.
 func (w *MultiRequest) SetTimeout(timeout time.Duration) {
-	if timeout > 0 && !w.timerSet {
+	if timeout <= 0 {
+		return
+	}
+	deadline := NowEpoch().Add(timeout)
+	if !w.timerSet {
 		w.timerSet = true
+		w.deadline = deadline
+		w.timer.After(timeout, w)
+	} else if deadline < w.deadline {
+		w.timer.Stop()
+		w.deadline = deadline
 		w.timer.After(timeout, w)
 	}
 }